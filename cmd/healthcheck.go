@@ -0,0 +1,94 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var healthURL string
+
+// healthcheckCmd represents the healthcheck command
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Checks the health of a running monitor",
+	Long: `Queries the health endpoint of a running monitor and exits with
+	a non zero status if it is not healthy. Meant for container health checks
+	where no other HTTP client is available. By default it queries /healthz at
+	the address set on http.listen in the configuration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		url := healthURL
+		if url == "" {
+			config, err := config.Load(cfgFile)
+			if err != nil {
+				log.Fatalf("Error loading configuration: %v", err)
+			}
+
+			if config.HTTP.Listen == "" {
+				log.Fatalf("No --url given and http.listen not set in the configuration")
+			}
+			url = config.HTTP.HealthURL()
+		}
+
+		err := checkHealth(url)
+		if err != nil {
+			fmt.Printf("unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// checkHealth queries the health endpoint printing its answer
+func checkHealth(url string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url) // #nosec G107 -- URL comes from the command line or configuration
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Print(string(body))
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(healthcheckCmd)
+
+	healthcheckCmd.Flags().StringVar(&healthURL, "url", "", "health endpoint to query (default derived from http.listen)")
+}
@@ -0,0 +1,343 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/pkg/database"
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat    string
+	importPrecision string
+	importBatchSize int
+	importOffset    int
+	importResume    bool
+	importDryRun    bool
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Loads archived data points into the configured database",
+	Long: `Reads data points from FILE and writes them in batches to the
+	database configured at .smartthings-influx.yaml. FILE can be CSV or JSON
+	Lines as written by the file database type, or InfluxDB line protocol,
+	optionally gzipped.
+
+	The number of points written to each database is kept at FILE.offset
+	after each batch so an interrupted import continues where it stopped
+	with --resume, databases already written are not written again.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := config.Load(cfgFile)
+		if err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+
+		if importBatchSize <= 0 {
+			log.Fatalf("--batch-size must be positive")
+		}
+
+		path := args[0]
+		offsetFile := path + ".offset"
+
+		// Dry run reads the file only, databases are not created
+		var mon *monitor.Monitor
+		var names []string
+		if importDryRun {
+			mon = config.InstantiateMonitorWithoutDatabases()
+		} else {
+			mon = config.InstantiateMonitor()
+			names = mon.RecorderNames()
+		}
+
+		offsets := map[string]int{}
+		for _, name := range append([]string{""}, names...) {
+			offsets[name] = importOffset
+		}
+		if importResume {
+			offsets, err = readOffsets(offsetFile, names)
+			if err != nil {
+				log.Fatalf("could not resume: %v", err)
+			}
+			log.Printf("Resuming import at points %v", offsets)
+		}
+
+		if !importDryRun {
+			err = mon.Open()
+			if err != nil {
+				log.Fatalf("could not open recorders: %v", err)
+			}
+		}
+
+		err = importFile(mon, path, names, offsets, func(offsets map[string]int) error {
+			if importDryRun {
+				return nil
+			}
+			return writeOffsets(offsetFile, offsets)
+		})
+		if !importDryRun {
+			if err := mon.Close(); err != nil {
+				log.Printf("ERROR: could not close recorders: %v", err)
+			}
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		if !importDryRun {
+			os.Remove(offsetFile)
+		}
+	},
+}
+
+// importFile imports the points of the file to the named recorders, all
+// of them when names is empty, skipping the points each was already given
+// according to offsets. saveOffsets is called with the number of points
+// written to each recorder after each batch.
+func importFile(mon *monitor.Monitor, path string, names []string, offsets map[string]int, saveOffsets func(map[string]int) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	counter := &countingReader{reader: file}
+	var in io.Reader = counter
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(counter)
+		if err != nil {
+			return fmt.Errorf("could not read gzip file: %w", err)
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	format := importFormat
+	if format == "" {
+		format = formatFromPath(path)
+	}
+
+	reader, err := database.NewPointReader(in, format, importPrecision)
+	if err != nil {
+		return err
+	}
+
+	targets := names
+	if len(targets) == 0 {
+		// All recorders at once
+		targets = []string{""}
+	}
+
+	offset := -1
+	for _, name := range targets {
+		if offset < 0 || offsets[name] < offset {
+			offset = offsets[name]
+		}
+	}
+
+	read, imported := 0, 0
+	for ; read < offset; read++ {
+		if _, err := reader.Next(); err != nil {
+			return fmt.Errorf("could not skip to offset %d: %w", offset, err)
+		}
+	}
+
+	done := false
+	for !done {
+		batch := make([]monitor.DeviceDataPoint, 0, importBatchSize)
+		for len(batch) < importBatchSize {
+			dp, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("could not read point %d: %w, continue with --resume once fixed", read+len(batch)+1, err)
+			}
+			batch = append(batch, dp)
+		}
+
+		end := read + len(batch)
+		written := 0
+		for _, name := range targets {
+			if offsets[name] >= end {
+				continue
+			}
+
+			recorders := []string{}
+			if name != "" {
+				recorders = append(recorders, name)
+			}
+			n, err := mon.Import(batch[max(offsets[name]-read, 0):], importDryRun, recorders...)
+			if err != nil {
+				if serr := saveOffsets(offsets); serr != nil {
+					log.Printf("ERROR: could not save offset: %v", serr)
+				}
+				return fmt.Errorf("%w, %d points read so far, continue with --resume", err, read)
+			}
+			offsets[name] = end
+			written = max(written, n)
+		}
+		read = end
+		imported += written
+
+		if err := saveOffsets(offsets); err != nil {
+			return fmt.Errorf("could not save offset: %w", err)
+		}
+
+		progress := 100.0
+		if info.Size() > 0 {
+			progress = float64(counter.count) * 100 / float64(info.Size())
+		}
+		log.Printf("Read %d points, imported %d (%.1f%%)", read, imported, progress)
+	}
+
+	if read > 0 && imported == 0 {
+		log.Printf("WARNING: none of the %d points read was selected, check the capabilities and device filters configured", read)
+	}
+
+	if importDryRun {
+		log.Printf("Dry run: %d points read, %d would be imported", read, imported)
+	} else {
+		log.Printf("Import finished: %d points read, %d imported", read, imported)
+	}
+
+	return nil
+}
+
+// formatFromPath guesses the format from the file extension.
+func formatFromPath(path string) string {
+	path = strings.TrimSuffix(path, ".gz")
+
+	switch {
+	case strings.HasSuffix(path, ".csv"):
+		return database.FormatCSV
+	case strings.HasSuffix(path, ".jsonl"), strings.HasSuffix(path, ".json"):
+		return database.FormatJSONL
+	case strings.HasSuffix(path, ".lp"), strings.HasSuffix(path, ".txt"):
+		return database.FormatLineProtocol
+	}
+
+	return ""
+}
+
+// readOffsets reads the points written to each recorder. An offset file
+// from an import to a single database keeps one number for all recorders.
+func readOffsets(path string, names []string) (map[string]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := map[string]int{}
+	if offset, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		for _, name := range append([]string{""}, names...) {
+			offsets[name] = offset
+		}
+
+		return offsets, nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		// Names may have spaces, the offset is after the last one
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid offset line %q", line)
+		}
+		name := line[:i]
+		offset, err := strconv.Atoi(line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset line %q: %w", line, err)
+		}
+		offsets[name] = offset
+	}
+
+	// Dry runs and databases added since start at the first point not
+	// written to all of them
+	first := -1
+	for _, offset := range offsets {
+		if first < 0 || offset < first {
+			first = offset
+		}
+	}
+	for _, name := range append([]string{""}, names...) {
+		if _, ok := offsets[name]; !ok {
+			offsets[name] = 0
+			if name == "" {
+				offsets[name] = first
+			}
+		}
+	}
+
+	return offsets, nil
+}
+
+// writeOffsets keeps the points written to each recorder, one recorder
+// name and offset per line.
+func writeOffsets(path string, offsets map[string]int) error {
+	lines := []string{}
+	for name, offset := range offsets {
+		if name == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %d", name, offset))
+	}
+	sort.Strings(lines)
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// countingReader counts the bytes read for progress.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVar(&importFormat, "format", "", "file format: jsonl, csv or lineprotocol, guessed from the extension when not set")
+	importCmd.Flags().StringVar(&importPrecision, "precision", "ns", "timestamp precision of line protocol: ns, us, ms or s")
+	importCmd.Flags().IntVar(&importBatchSize, "batch-size", 5000, "points written per batch")
+	importCmd.Flags().IntVar(&importOffset, "offset", 0, "number of points to skip at the start of the file")
+	importCmd.Flags().BoolVar(&importResume, "resume", false, "continue an interrupted import from the offsets saved at FILE.offset")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "read the file and report what would be imported without writing")
+}
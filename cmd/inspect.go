@@ -18,11 +18,16 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/pkg/database"
 	"github.com/spf13/cobra"
 )
 
+var inspectFormat string
+
 // inspectCmd represents the monitor command.
 var inspectCmd = &cobra.Command{
 	Use:   "inspect",
@@ -37,13 +42,27 @@ var inspectCmd = &cobra.Command{
 
 		// Monitor
 		mon := config.InstantiateMonitor()
+		defer mon.Close()
 
 		data, err := mon.InspectDevices()
 		if err != nil {
 			log.Fatalf("%v", err)
 		}
 
-		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		switch inspectFormat {
+		case "table":
+		case database.FormatLineProtocol:
+			lines, err := database.MarshalLineProtocol(data, "ns")
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			os.Stdout.Write(lines)
+			return
+		default:
+			log.Fatalf("invalid format %q, must be table or %s", inspectFormat, database.FormatLineProtocol)
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
 			"Order",
 			"Metric",
 			"Device",
@@ -51,9 +70,16 @@ var inspectCmd = &cobra.Command{
 			"Capability",
 			"Value",
 			"Timestamp",
+			"Age",
+			"Next due",
 		)
 		for i, dp := range data {
-			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%.2f %s\t%s\n",
+			age := "-"
+			if !dp.PolledAt.IsZero() {
+				age = dp.Age.String()
+			}
+
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%.2f %s\t%s\t%s\t%s\n",
 				i+1,
 				dp.Key,
 				dp.Device,
@@ -62,6 +88,8 @@ var inspectCmd = &cobra.Command{
 				dp.Value,
 				dp.Unit,
 				dp.Timestamp.String(),
+				age,
+				mon.NextDue(dp).Format(time.RFC3339),
 			)
 		}
 	},
@@ -70,6 +98,8 @@ var inspectCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(inspectCmd)
 
+	inspectCmd.Flags().StringVar(&inspectFormat, "format", "table", "output format: table or lineprotocol")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -20,6 +20,7 @@ import (
 	"log"
 
 	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
 	"github.com/eargollo/smartthings-influx/pkg/smartthings"
 	"github.com/spf13/cobra"
 )
@@ -31,6 +32,8 @@ var listCmd = &cobra.Command{
 	Long: `Query SmartThings for:
 	   - Devices
 	   - Capabilities
+	   Devices are flagged as included or excluded according to the
+	   device filters in the configuration.
 	   `,
 	Run: func(cmd *cobra.Command, args []string) {
 		config, err := config.Load(cfgFile)
@@ -45,8 +48,25 @@ var listCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		// Only filters are needed, databases are not touched
+		filters, err := config.DeviceFilters()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		mon := monitor.New(monitor.SetClient(client), monitor.WithDeviceFilters(filters))
+
 		for i, d := range list.Items {
-			fmt.Printf("%d: %s, %s, %s\n", i, d.DeviceId, d.Name, d.Label)
+			filter := "included"
+			if !mon.DeviceIncluded(d) {
+				filter = "excluded"
+			}
+
+			room := mon.RoomName(d)
+			if room != "" {
+				fmt.Printf("%d: %s, %s, %s, %s [%s]\n", i, d.DeviceId, d.Name, d.Label, room, filter)
+			} else {
+				fmt.Printf("%d: %s, %s, %s [%s]\n", i, d.DeviceId, d.Name, d.Label, filter)
+			}
 			for _, comp := range d.Components {
 				for _, cap := range comp.Capabilities {
 					fmt.Printf("   | %s\n", cap.Id)
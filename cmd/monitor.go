@@ -16,9 +16,14 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/internal/server"
 	"github.com/spf13/cobra"
 )
 
@@ -38,7 +43,32 @@ var monitorCmd = &cobra.Command{
 		// Monitor
 		mon := config.InstantiateMonitor()
 
-		err = mon.Run()
+		if len(config.DatabasesOfType("prometheus")) > 0 && config.HTTP.Listen == "" {
+			log.Fatalf("database type prometheus serves readings on /metrics and requires http.listen to be set")
+		}
+
+		if config.HTTP.Listen != "" {
+			srv := server.New(config.HTTP.Listen)
+			srv.Handle("/healthz", server.Check(func() error { return mon.Liveness(config.HTTP.Liveness()) }))
+			srv.Handle("/readyz", server.Check(mon.Readiness))
+			srv.Start()
+		}
+
+		// SIGHUP forces the device inventory to be refreshed
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				log.Printf("Got SIGHUP, refreshing device inventory at next cycle")
+				mon.RefreshInventory()
+			}
+		}()
+
+		// Recorders are flushed and closed on interrupt or termination
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = mon.RunContext(ctx)
 		if err != nil {
 			log.Fatalf("%v", err)
 		}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queryDevice    string
+	queryAttribute string
+	queryFrom      string
+	queryTo        string
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Prints readings recorded in the SQLite database as CSV",
+	Long: `Prints the readings of an attribute of a device recorded in the
+	SQLite database configured at .smartthings-influx.yaml as CSV.
+	--from and --to take a time in RFC3339 format or a duration before now.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := config.Load(cfgFile)
+		if err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+
+		sqlite := config.DatabasesOfType("sqlite")
+		if len(sqlite) == 0 {
+			log.Fatalf("query requires database type sqlite")
+		}
+
+		now := time.Now()
+		from, err := parseQueryTime(queryFrom, now)
+		if err != nil {
+			log.Fatalf("invalid --from: %v", err)
+		}
+		to, err := parseQueryTime(queryTo, now)
+		if err != nil {
+			log.Fatalf("invalid --to: %v", err)
+		}
+
+		db, err := database.NewSQLiteClient(sqlite[0].Path, 0)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer db.Close()
+
+		readings, err := db.Query(queryDevice, queryAttribute, from, to)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		err = w.Write([]string{"time", "device_id", "device", "room", "component", "capability", "attribute", "unit", "value"})
+		if err != nil {
+			log.Fatalf("Error writing csv: %v", err)
+		}
+		for _, r := range readings {
+			err = w.Write([]string{
+				r.Timestamp.Format(time.RFC3339),
+				r.DeviceId.String(),
+				r.Device,
+				r.Room,
+				r.Component,
+				r.Capability,
+				r.Key,
+				r.Unit,
+				strconv.FormatFloat(r.Value, 'f', -1, 64),
+			})
+			if err != nil {
+				log.Fatalf("Error writing csv: %v", err)
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatalf("Error writing csv: %v", err)
+		}
+	},
+}
+
+// parseQueryTime parses a time in RFC3339 format or a duration before now.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither a RFC3339 time nor a duration", value)
+	}
+
+	return t, nil
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+
+	queryCmd.Flags().StringVar(&queryDevice, "device", "", "device label or ID")
+	queryCmd.Flags().StringVar(&queryAttribute, "attribute", "", "attribute name, for instance temperature")
+	queryCmd.Flags().StringVar(&queryFrom, "from", "24h", "start of the range")
+	queryCmd.Flags().StringVar(&queryTo, "to", "", "end of the range, defaults to now")
+	for _, flag := range []string{"device", "attribute"} {
+		err := queryCmd.MarkFlagRequired(flag)
+		if err != nil {
+			log.Fatalf("Error on marking flag required: %v", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/internal/config"
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/spf13/cobra"
+)
+
+var staleAge time.Duration
+
+// staleCmd represents the stale command
+var staleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "Lists sensors whose last reading is older than a given age",
+	Long: `Runs a single pass on SmartThings like inspect and lists the
+	devices and attributes whose last reading is older than --age.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := config.Load(cfgFile)
+		if err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+
+		// Monitor, stale only reads from SmartThings
+		mon := config.InstantiateMonitorWithoutDatabases()
+
+		data, err := mon.InspectDevices()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		stale := monitor.StaleReadings(data, staleAge, time.Now())
+		sort.Slice(stale, func(i, j int) bool { return stale[i].Age > stale[j].Age })
+
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n",
+			"Device",
+			"Component",
+			"Capability",
+			"Attribute",
+			"Last reading",
+			"Age",
+		)
+		for _, s := range stale {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.Point.Device,
+				s.Point.Component,
+				s.Point.Capability,
+				s.Point.Key,
+				s.Point.SensorTime.Format(time.RFC3339),
+				s.Age.Truncate(time.Second).String(),
+			)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(staleCmd)
+
+	staleCmd.Flags().DurationVar(&staleAge, "age", 24*time.Hour, "minimum age of the last reading")
+}
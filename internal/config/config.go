@@ -3,13 +3,17 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/eargollo/smartthings-influx/pkg/database"
 	"github.com/eargollo/smartthings-influx/pkg/monitor"
 	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+	"github.com/mitchellh/mapstructure"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 )
 
@@ -23,14 +27,56 @@ type Config struct {
 	InfluxDatabase string                `yaml:"influxdatabase"`
 	ValueMap       monitor.ConversionMap `yaml:"valuemap,omitempty"`
 	Database       *DatabaseConfig       `yaml:"influxdbv2,omitempty"`
-	SmartThings    SmartThingsConfig     `yaml:"smartthings,omitempty"`
+	// Databases are written along with Database, each independently
+	Databases []DatabaseConfig `yaml:"databases,omitempty"`
+	// WriteTimeout bounds the write to each database at every cycle
+	WriteTimeout time.Duration     `yaml:"write_timeout,omitempty" mapstructure:"write_timeout"`
+	SmartThings  SmartThingsConfig `yaml:"smartthings,omitempty"`
+	HTTP         HTTPConfig        `yaml:"http,omitempty"`
+}
+
+// HTTPConfig sets the HTTP listener exposing the monitor metrics and
+// health checks. The listener is disabled when Listen is empty.
+type HTTPConfig struct {
+	Listen string `yaml:"listen"`
+	// LivenessPeriods is how many monitor periods without a successful
+	// cycle make the monitor not live. Defaults to 3.
+	LivenessPeriods int `yaml:"liveness_periods" mapstructure:"liveness_periods"`
+}
+
+const defaultLivenessPeriods = 3
+
+// Liveness returns the liveness periods or its default.
+func (h HTTPConfig) Liveness() int {
+	if h.LivenessPeriods <= 0 {
+		return defaultLivenessPeriods
+	}
+
+	return h.LivenessPeriods
+}
+
+// HealthURL returns the URL of the health check endpoint at the local host.
+func (h HTTPConfig) HealthURL() string {
+	host, port, err := net.SplitHostPort(h.Listen)
+	if err != nil || host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	return "http://" + net.JoinHostPort(host, port) + "/healthz"
 }
 
 type SmartThingsConfig struct {
 	Capabilities monitor.MonitorCapabilities `yaml:"capabilities,omitempty"`
+	Include      monitor.DeviceFilter        `yaml:"include,omitempty"`
+	Exclude      monitor.DeviceFilter        `yaml:"exclude,omitempty"`
+	Devices      monitor.DeviceOverrides     `yaml:"devices,omitempty"`
+	// InventoryRefresh is how long the device list is cached between cycles
+	InventoryRefresh time.Duration `yaml:"inventory_refresh,omitempty" mapstructure:"inventory_refresh"`
 }
 
 type DatabaseConfig struct {
+	// Name identifies the database in logs and metrics, defaults to its type
+	Name     string `yaml:"name"`
 	Type     string `yaml:"type"`
 	URL      string `yaml:"url"`
 	Token    string `yaml:"token"`
@@ -39,6 +85,38 @@ type DatabaseConfig struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Database string `yaml:"database"`
+	// MQTT settings
+	ClientID        string `yaml:"client_id" mapstructure:"client_id"`
+	Topic           string `yaml:"topic"`
+	QoS             byte   `yaml:"qos"`
+	Retain          bool   `yaml:"retain"`
+	Discovery       bool   `yaml:"discovery"`
+	DiscoveryPrefix string `yaml:"discovery_prefix" mapstructure:"discovery_prefix"`
+	// Timescale stores PostgreSQL readings in a TimescaleDB hypertable
+	Timescale bool `yaml:"timescale"`
+	// SQLite settings, retention is shared with InfluxDB
+	Path      string        `yaml:"path"`
+	Retention time.Duration `yaml:"retention"`
+	// InfluxDB provisioning, creates the bucket, database or retention
+	// policy when missing
+	Create          bool   `yaml:"create"`
+	RetentionPolicy string `yaml:"retention_policy" mapstructure:"retention_policy"`
+	// File settings, path is shared with SQLite
+	Format   string        `yaml:"format"`
+	MaxSize  int64         `yaml:"max_size" mapstructure:"max_size"`
+	Rotate   time.Duration `yaml:"rotate"`
+	Compress bool          `yaml:"compress"`
+	// Line protocol settings
+	Headers   map[string]string `yaml:"headers"`
+	Precision string            `yaml:"precision"`
+	// Graphite settings
+	Template string `yaml:"template"`
+	Tagged   bool   `yaml:"tagged"`
+	// OTLP protocol, grpc or http. Headers are shared with line protocol.
+	Protocol string `yaml:"protocol"`
+	// Prometheus exporter staleness, series not updated for longer are
+	// no longer exposed
+	Staleness time.Duration `yaml:"staleness"`
 }
 
 func Load(cfgFile string) (*Config, error) {
@@ -68,7 +146,11 @@ func Load(cfgFile string) (*Config, error) {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 
-	err := viper.Unmarshal(conf)
+	err := viper.Unmarshal(conf, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		deviceOverridesHook,
+	)))
 
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling config file: %w", err)
@@ -77,7 +159,72 @@ func Load(cfgFile string) (*Config, error) {
 	return conf, err
 }
 
+// deviceOverridesHook decodes device overrides configured as a list,
+// keyed by their device field. Map keys with dots are split by viper
+// into nested keys, so labels such as "Kitchen 1.2" need the list.
+func deviceOverridesHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(monitor.DeviceOverrides{}) || from.Kind() != reflect.Slice {
+		return data, nil
+	}
+
+	items, ok := data.([]interface{})
+	if !ok {
+		return data, nil
+	}
+
+	overrides := make(map[string]interface{}, len(items))
+	for i, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("device override %d is not a map", i)
+		}
+
+		override := make(map[string]interface{}, len(entry))
+		device := ""
+		for k, v := range entry {
+			if strings.EqualFold(k, monitor.DeviceOverrideKey) {
+				device = fmt.Sprint(v)
+
+				continue
+			}
+			override[k] = v
+		}
+
+		if device == "" {
+			return nil, fmt.Errorf("device override %d has no %s", i, monitor.DeviceOverrideKey)
+		}
+		if _, ok := overrides[device]; ok {
+			return nil, fmt.Errorf("device %q is overridden twice", device)
+		}
+		overrides[device] = override
+	}
+
+	return overrides, nil
+}
+
 func (c *Config) InstantiateMonitor() *monitor.Monitor {
+	parms := c.monitorOptions()
+
+	recorders, err := c.Recorders()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for _, r := range recorders {
+		parms = append(parms, monitor.AddRecorder(r.Name, r.Recorder))
+	}
+
+	return monitor.New(parms...)
+}
+
+// InstantiateMonitorWithoutDatabases instantiates the monitor without
+// creating the databases, for commands that only read. It records to
+// stdout.
+func (c *Config) InstantiateMonitorWithoutDatabases() *monitor.Monitor {
+	return monitor.New(c.monitorOptions()...)
+}
+
+// monitorOptions returns the monitor options but the recorders.
+func (c *Config) monitorOptions() []monitor.MonitorOption {
 	parms := []monitor.MonitorOption{}
 
 	if c.APIToken != "" {
@@ -94,32 +241,24 @@ func (c *Config) InstantiateMonitor() *monitor.Monitor {
 		parms = append(parms, monitor.Capabilities(caps))
 	}
 
-	if c.Database == nil {
-		// Keeping compatibility with previous configuration file
-		// To be deprecated in the future
-		if c.InfluxDatabase != "" || c.InfluxPassword != "" || c.InfluxURL != "" || c.InfluxUser != "" {
-			db, err := database.NewInfluxDBClient(c.InfluxURL, c.InfluxUser, c.InfluxPassword, c.InfluxDatabase)
-			if err != nil {
-				log.Fatalf("could not initialize influx: %v", err)
-			}
-			parms = append(parms, monitor.SetRecorder(db))
-		}
-	} else {
-		// Database object factory
-		switch strings.ToLower(c.Database.Type) {
-		case "influxdbv2":
-			db, err := database.NewInfluxDBv2Client(c.Database.URL, c.Database.Token, c.Database.Org, c.Database.Bucket)
-			if err != nil {
-				log.Fatalf("could not initialize influx v2: %v", err)
-			}
-			parms = append(parms, monitor.SetRecorder(db))
-		case "influxdbv1":
-			db, err := database.NewInfluxDBClient(c.Database.URL, c.Database.User, c.Database.Password, c.Database.Database)
-			if err != nil {
-				log.Fatalf("could not initialize influx: %v", err)
-			}
-			parms = append(parms, monitor.SetRecorder(db))
-		}
+	filters, err := c.DeviceFilters()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if !filters.Include.IsEmpty() || !filters.Exclude.IsEmpty() {
+		parms = append(parms, monitor.WithDeviceFilters(filters))
+	}
+
+	if len(c.SmartThings.Devices) > 0 {
+		parms = append(parms, monitor.WithDeviceOverrides(c.SmartThings.Devices))
+	}
+
+	if c.SmartThings.InventoryRefresh > 0 {
+		parms = append(parms, monitor.WithInventoryRefresh(c.SmartThings.InventoryRefresh))
+	}
+
+	if c.WriteTimeout > 0 {
+		parms = append(parms, monitor.WithWriteTimeout(c.WriteTimeout))
 	}
 
 	if c.Period != 0 {
@@ -130,5 +269,160 @@ func (c *Config) InstantiateMonitor() *monitor.Monitor {
 		parms = append(parms, monitor.WithConversion(c.ValueMap))
 	}
 
-	return monitor.New(parms...)
+	return parms
+}
+
+// DeviceFilters returns the validated device filters.
+func (c *Config) DeviceFilters() (monitor.DeviceFilters, error) {
+	filters := monitor.DeviceFilters{Include: c.SmartThings.Include, Exclude: c.SmartThings.Exclude}
+	if err := filters.Validate(); err != nil {
+		return filters, fmt.Errorf("invalid device filters: %w", err)
+	}
+
+	return filters, nil
+}
+
+// Recorder creates the recorder of the database.
+func (d DatabaseConfig) Recorder() (monitor.Recorder, error) {
+	// Database object factory
+	switch strings.ToLower(d.Type) {
+	case "influxdbv2":
+		db, err := database.NewInfluxDBv2Client(d.URL, d.Token, d.Org, d.Bucket, d.influxProvisioning())
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize influx v2: %w", err)
+		}
+		return db, nil
+	case "influxdbv1":
+		db, err := database.NewInfluxDBClient(d.URL, d.User, d.Password, d.Database, d.influxProvisioning())
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize influx: %w", err)
+		}
+		return db, nil
+	case "remotewrite":
+		db, err := database.NewRemoteWriteClient(d.URL, d.User, d.Password, d.Token)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize remote write: %w", err)
+		}
+		return db, nil
+	case "mqtt":
+		db, err := database.NewMQTTClient(database.MQTTConfig{
+			Broker:          d.URL,
+			ClientID:        d.ClientID,
+			User:            d.User,
+			Password:        d.Password,
+			Topic:           d.Topic,
+			QoS:             d.QoS,
+			Retain:          d.Retain,
+			Discovery:       d.Discovery,
+			DiscoveryPrefix: d.DiscoveryPrefix,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize mqtt: %w", err)
+		}
+		return db, nil
+	case "postgres":
+		db, err := database.NewPostgresClient(d.URL, d.Timescale)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize postgres: %w", err)
+		}
+		return db, nil
+	case "sqlite":
+		db, err := database.NewSQLiteClient(d.Path, d.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize sqlite: %w", err)
+		}
+		return db, nil
+	case "file":
+		db, err := database.NewFileRecorder(d.Path, d.Format, d.MaxSize, d.Rotate, d.Compress)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize file recorder: %w", err)
+		}
+		return db, nil
+	case "lineprotocol":
+		db, err := database.NewLineProtocolClient(d.URL, d.Headers, d.Precision)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize line protocol: %w", err)
+		}
+		return db, nil
+	case "graphite":
+		db, err := database.NewGraphiteClient(d.URL, d.Template, d.Tagged)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize graphite: %w", err)
+		}
+		return db, nil
+	case "otlp":
+		db, err := database.NewOTLPClient(d.URL, d.Protocol, d.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize otlp: %w", err)
+		}
+		return db, nil
+	case "prometheus":
+		db, err := database.NewPrometheusExporter(prometheus.DefaultRegisterer, d.Staleness)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize prometheus exporter: %w", err)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown database type %q", d.Type)
+	}
+}
+
+func (d DatabaseConfig) influxProvisioning() database.InfluxProvisioning {
+	return database.InfluxProvisioning{Create: d.Create, Retention: d.Retention, RetentionPolicy: d.RetentionPolicy}
+}
+
+// DatabaseConfigs returns the configured databases. The previous influx
+// settings are used when there is none.
+func (c *Config) DatabaseConfigs() []DatabaseConfig {
+	dbs := []DatabaseConfig{}
+	if c.Database != nil {
+		dbs = append(dbs, *c.Database)
+	}
+	dbs = append(dbs, c.Databases...)
+
+	// Keeping compatibility with previous configuration file
+	// To be deprecated in the future
+	if len(dbs) == 0 && (c.InfluxDatabase != "" || c.InfluxPassword != "" || c.InfluxURL != "" || c.InfluxUser != "") {
+		dbs = append(dbs, DatabaseConfig{Type: "influxdbv1", URL: c.InfluxURL, User: c.InfluxUser, Password: c.InfluxPassword, Database: c.InfluxDatabase})
+	}
+
+	for i := range dbs {
+		if dbs[i].Name == "" {
+			dbs[i].Name = strings.ToLower(dbs[i].Type)
+		}
+	}
+
+	return dbs
+}
+
+// DatabasesOfType returns the configured databases of the given type.
+func (c *Config) DatabasesOfType(dbType string) []DatabaseConfig {
+	dbs := []DatabaseConfig{}
+	for _, d := range c.DatabaseConfigs() {
+		if strings.EqualFold(d.Type, dbType) {
+			dbs = append(dbs, d)
+		}
+	}
+
+	return dbs
+}
+
+// Recorders creates the recorders of the configured databases.
+func (c *Config) Recorders() ([]monitor.NamedRecorder, error) {
+	recorders := []monitor.NamedRecorder{}
+	names := map[string]bool{}
+	for _, d := range c.DatabaseConfigs() {
+		if names[d.Name] {
+			return nil, fmt.Errorf("duplicate database name %q, set a unique name for each database", d.Name)
+		}
+		names[d.Name] = true
+
+		db, err := d.Recorder()
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", d.Name, err)
+		}
+		recorders = append(recorders, monitor.NamedRecorder{Name: d.Name, Recorder: db})
+	}
+
+	return recorders, nil
 }
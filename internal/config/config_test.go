@@ -2,6 +2,7 @@ package config
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,8 @@ import (
 func TestLoad(t *testing.T) {
 	t.Setenv("APITOKEN", "1")
 
+	dedupOn, dedupOff := true, false
+
 	tests := []struct {
 		name    string
 		file    string
@@ -38,6 +41,58 @@ func TestLoad(t *testing.T) {
 				},
 			},
 		}, wantErr: false},
+		{name: "attributes", file: "testdata/attributes.yaml", want: &Config{
+			SmartThings: SmartThingsConfig{
+				Capabilities: monitor.MonitorCapabilities{
+					monitor.MonitorCapability{Name: "thermostatCoolingSetpoint", Time: monitor.SensorTime, Attributes: []string{"coolingSetpoint"}},
+					monitor.MonitorCapability{Name: "powerMeter", ExcludeAttributes: []string{"powerConsumption"}, Interval: 30 * time.Second,
+						Deadband: monitor.Deadband{Absolute: 5, Percent: 1.5, MaxSilence: 30 * time.Minute}},
+				},
+			},
+		}, wantErr: false},
+		{name: "filters", file: "testdata/filters.yaml", want: &Config{
+			SmartThings: SmartThingsConfig{
+				InventoryRefresh: 30 * time.Minute,
+				Include:          monitor.DeviceFilter{Rooms: []string{"Living Room"}, LabelRegex: []string{"^Sensor"}},
+				Exclude:          monitor.DeviceFilter{IDs: []string{"27118afd-2f98-425c-8211-899eb596edad"}, Names: []string{"c2c-*"}},
+			},
+		}, wantErr: false},
+		{name: "device overrides", file: "testdata/devices.yaml", want: &Config{
+			SmartThings: SmartThingsConfig{
+				Capabilities: monitor.MonitorCapabilities{
+					monitor.MonitorCapability{Name: "switch", Time: monitor.WallTime, Dedup: &dedupOff},
+				},
+				Devices: monitor.DeviceOverrides{
+					"27118afd-2f98-425c-8211-899eb596edad": monitor.DeviceOverride{
+						CapabilityOverride: monitor.CapabilityOverride{Time: monitor.SensorTime, Dedup: &dedupOn},
+					},
+					"living room lamp": monitor.DeviceOverride{
+						CapabilityOverride: monitor.CapabilityOverride{ValueMap: monitor.ConversionMap{"switch": {"on": 100, "off": 0}}},
+						Capabilities: map[string]monitor.CapabilityOverride{
+							"switchlevel": {Time: monitor.WallTime},
+						},
+					},
+				},
+			},
+		}, wantErr: false},
+		{name: "device overrides list", file: "testdata/devices-list.yaml", want: &Config{
+			SmartThings: SmartThingsConfig{
+				Capabilities: monitor.MonitorCapabilities{
+					monitor.MonitorCapability{Name: "temperatureMeasurement", Heartbeat: time.Hour},
+				},
+				Devices: monitor.DeviceOverrides{
+					"Kitchen 1.2": monitor.DeviceOverride{
+						CapabilityOverride: monitor.CapabilityOverride{Heartbeat: 10 * time.Minute, Deadband: monitor.Deadband{Absolute: 0.5}, Stale: 2 * time.Hour},
+					},
+					"27118afd-2f98-425c-8211-899eb596edad": monitor.DeviceOverride{
+						CapabilityOverride: monitor.CapabilityOverride{Dedup: &dedupOff},
+						Capabilities: map[string]monitor.CapabilityOverride{
+							"temperaturemeasurement": {Time: monitor.WallTime},
+						},
+					},
+				},
+			},
+		}, wantErr: false},
 		{name: "influx v2 base", file: "testdata/influxv2-base.yaml", want: &Config{
 			APIToken: "1",
 			Monitor:  []string{"light", "temperatureMeasurement", "illuminanceMeasurement", "relativeHumidityMeasurement", "ultravioletIndex"},
@@ -56,6 +111,15 @@ func TestLoad(t *testing.T) {
 			Database:       &DatabaseConfig{Type: "influxdbv2", URL: "http://localhost:8086", Token: "token", Org: "org", Bucket: "bucket"},
 			ValueMap:       map[string]map[string]float64{"switch": map[string]float64{"on": 1, "off": 0}},
 		}, wantErr: false},
+		{name: "databases", file: "testdata/databases.yaml", want: &Config{
+			APIToken: "1",
+			Period:   120,
+			Databases: []DatabaseConfig{
+				{Type: "influxdbv2", URL: "http://localhost:8086", Token: "token", Org: "org", Bucket: "bucket", Create: true, Retention: 720 * time.Hour},
+				{Name: "archive", Type: "file", Path: "/var/lib/smartthings-influx/readings.jsonl", Format: "jsonl"},
+				{Type: "prometheus"},
+			},
+		}, wantErr: false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -72,7 +136,7 @@ func TestLoad(t *testing.T) {
 }
 
 func TestConfig_InstantiateMonitor(t *testing.T) {
-	influx, err := database.NewInfluxDBClient("http://url", "user", "pass", "database")
+	influx, err := database.NewInfluxDBClient("http://url", "user", "pass", "database", database.InfluxProvisioning{})
 	if err != nil {
 		t.Errorf("Could not initialize influx %v", err)
 	}
@@ -126,7 +190,7 @@ func TestConfig_InstantiateMonitor(t *testing.T) {
 						monitor.MonitorCapability{Name: "c", Time: monitor.SensorTime},
 					}),
 				monitor.WithPeriod(6*time.Minute),
-				monitor.SetRecorder(influx),
+				monitor.AddRecorder("influxdbv1", influx),
 				monitor.WithConversion(map[string]map[string]float64{"switch": {"on": 1, "off": 0}}),
 			),
 		},
@@ -146,10 +210,23 @@ func TestConfig_InstantiateMonitor(t *testing.T) {
 						monitor.MonitorCapability{Name: "c", Time: monitor.SensorTime},
 					}),
 				monitor.WithPeriod(6*time.Minute),
-				monitor.SetRecorder(influx),
+				monitor.AddRecorder("influxdbv1", influx),
 				monitor.WithConversion(map[string]map[string]float64{"switch": {"on": 1, "off": 0}}),
 			), // cant test influx 2 cause it is different at every instantiation
 		},
+		{
+			name: "multiple databases",
+			config: &Config{
+				Database: &DatabaseConfig{Type: "influxdbv1", URL: "http://url", User: "user", Password: "pass", Database: "database"},
+				Databases: []DatabaseConfig{
+					{Name: "backup", Type: "influxdbv1", URL: "http://url", User: "user", Password: "pass", Database: "database"},
+				},
+			},
+			want: monitor.New(
+				monitor.AddRecorder("influxdbv1", influx),
+				monitor.AddRecorder("backup", influx),
+			),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -159,3 +236,64 @@ func TestConfig_InstantiateMonitor(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Recorders(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		want    []string
+		wantErr string
+	}{
+		{name: "none", config: &Config{}, want: []string{}},
+		{name: "previous influx settings", config: &Config{InfluxURL: "http://url"}, want: []string{"influxdbv1"}},
+		{name: "database and databases", config: &Config{
+			Database:  &DatabaseConfig{Type: "InfluxDBv1", URL: "http://url"},
+			Databases: []DatabaseConfig{{Name: "archive", Type: "influxdbv1", URL: "http://b"}},
+		}, want: []string{"influxdbv1", "archive"}},
+		{name: "duplicate names", config: &Config{
+			Databases: []DatabaseConfig{{Type: "influxdbv1", URL: "http://a"}, {Type: "influxdbv1", URL: "http://b"}},
+		}, wantErr: `duplicate database name "influxdbv1"`},
+		{name: "unknown type", config: &Config{
+			Databases: []DatabaseConfig{{Type: "cassandra"}},
+		}, wantErr: `database cassandra: unknown database type "cassandra"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Recorders()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Config.Recorders() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Config.Recorders() error = %v", err)
+			}
+			names := []string{}
+			for _, r := range got {
+				names = append(names, r.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("Config.Recorders() names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPConfig_HealthURL(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{listen: ":9100", want: "http://localhost:9100/healthz"},
+		{listen: "0.0.0.0:9100", want: "http://localhost:9100/healthz"},
+		{listen: "127.0.0.1:8080", want: "http://127.0.0.1:8080/healthz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			if got := (HTTPConfig{Listen: tt.listen}).HealthURL(); got != tt.want {
+				t.Errorf("HTTPConfig.HealthURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
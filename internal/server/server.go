@@ -0,0 +1,69 @@
+// Package server runs the HTTP listener exposing the monitor metrics.
+package server
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
+)
+
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates a server listening at the given address that serves the
+// Prometheus metrics at /metrics.
+func New(listen string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle adds a handler to the server.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the server routes.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start listens in the background. Failing to listen is fatal.
+func (s *Server) Start() {
+	go func() {
+		log.Printf("HTTP server listening at %s", s.server.Addr)
+		err := s.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+}
+
+// Check serves a health check. It answers 200 when check returns no
+// error and 503 with the error message otherwise.
+func Check(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(err.Error() + "\n"))
+
+			return
+		}
+
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
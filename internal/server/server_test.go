@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	metrics.ObserveWrite("test", 3, 1)
+	metrics.DedupSkips.WithLabelValues("database").Inc()
+
+	ts := httptest.NewServer(New(":0").Handler())
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`smartthings_influx_points_written_total{recorder="test"} 3`,
+		`smartthings_influx_points_failed_total{recorder="test"} 1`,
+		`smartthings_influx_dedup_skips_total`,
+		`smartthings_influx_inventory_cache_age_seconds`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("GET /metrics missing %s", want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    func() error
+		wantCode int
+		wantBody string
+	}{
+		{name: "healthy", check: func() error { return nil }, wantCode: 200, wantBody: "ok\n"},
+		{name: "unhealthy", check: func() error { return errors.New("recorder unreachable") }, wantCode: 503, wantBody: "recorder unreachable\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Check(tt.check).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("Check() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("Check() body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+)
+
+// File formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// FileColumns are the CSV columns, in the order written, of file records.
+var FileColumns = []string{"time", "measurement", "device_id", "device", "room", "component", "capability", "unit", "value", "tags", "heartbeat", "sensor_time", "polled_at", "age_seconds"}
+
+// FileRecord is a data point as written to files.
+type FileRecord struct {
+	Time        time.Time         `json:"time"`
+	Measurement string            `json:"measurement"`
+	DeviceId    uuid.UUID         `json:"device_id"`
+	Device      string            `json:"device"`
+	Room        string            `json:"room,omitempty"`
+	Component   string            `json:"component"`
+	Capability  string            `json:"capability"`
+	Unit        string            `json:"unit,omitempty"`
+	Value       float64           `json:"value"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Heartbeat   bool              `json:"heartbeat,omitempty"`
+	SensorTime  time.Time         `json:"sensor_time"`
+	PolledAt    *time.Time        `json:"polled_at,omitempty"`
+	AgeSeconds  *float64          `json:"age_seconds,omitempty"`
+}
+
+// NewFileRecord converts a data point to its file record.
+func NewFileRecord(dp monitor.DeviceDataPoint) FileRecord {
+	r := FileRecord{
+		Time:        dp.Timestamp,
+		Measurement: dp.Key,
+		DeviceId:    dp.DeviceId,
+		Device:      dp.Device,
+		Room:        dp.Room,
+		Component:   dp.Component,
+		Capability:  dp.Capability,
+		Unit:        dp.Unit,
+		Value:       dp.Value,
+		Tags:        dp.Tags,
+		Heartbeat:   dp.Heartbeat,
+		SensorTime:  dp.SensorTime,
+	}
+
+	if !dp.PolledAt.IsZero() {
+		polledAt := dp.PolledAt
+		age := dp.Age.Seconds()
+		r.PolledAt = &polledAt
+		r.AgeSeconds = &age
+	}
+
+	return r
+}
+
+// Point converts the record back to a data point.
+func (r FileRecord) Point() monitor.DeviceDataPoint {
+	dp := monitor.DeviceDataPoint{
+		Key:        r.Measurement,
+		DeviceId:   r.DeviceId,
+		Device:     r.Device,
+		Room:       r.Room,
+		Component:  r.Component,
+		Capability: r.Capability,
+		Unit:       r.Unit,
+		Value:      r.Value,
+		Timestamp:  r.Time,
+		SensorTime: r.SensorTime,
+		Tags:       r.Tags,
+		Heartbeat:  r.Heartbeat,
+	}
+
+	if r.PolledAt != nil {
+		dp.PolledAt = *r.PolledAt
+	}
+	if r.AgeSeconds != nil {
+		dp.Age = time.Duration(*r.AgeSeconds * float64(time.Second))
+	}
+
+	return dp
+}
+
+// CSV returns the record as a row of FileColumns.
+func (r FileRecord) CSV() []string {
+	tags := ""
+	if len(r.Tags) > 0 {
+		b, _ := json.Marshal(r.Tags)
+		tags = string(b)
+	}
+
+	polledAt, age := "", ""
+	if r.PolledAt != nil {
+		polledAt = r.PolledAt.Format(time.RFC3339Nano)
+	}
+	if r.AgeSeconds != nil {
+		age = strconv.FormatFloat(*r.AgeSeconds, 'f', -1, 64)
+	}
+
+	return []string{
+		r.Time.Format(time.RFC3339Nano),
+		r.Measurement,
+		r.DeviceId.String(),
+		r.Device,
+		r.Room,
+		r.Component,
+		r.Capability,
+		r.Unit,
+		strconv.FormatFloat(r.Value, 'f', -1, 64),
+		tags,
+		strconv.FormatBool(r.Heartbeat),
+		r.SensorTime.Format(time.RFC3339Nano),
+		polledAt,
+		age,
+	}
+}
+
+// ParseFileRecordCSV parses a row of FileColumns.
+func ParseFileRecordCSV(row []string) (FileRecord, error) {
+	r := FileRecord{}
+
+	if len(row) != len(FileColumns) {
+		return r, fmt.Errorf("expected %d columns, got %d", len(FileColumns), len(row))
+	}
+
+	var err error
+	if r.Time, err = time.Parse(time.RFC3339Nano, row[0]); err != nil {
+		return r, fmt.Errorf("invalid time: %w", err)
+	}
+	r.Measurement = row[1]
+	if r.DeviceId, err = uuid.Parse(row[2]); err != nil {
+		return r, fmt.Errorf("invalid device_id: %w", err)
+	}
+	r.Device, r.Room, r.Component, r.Capability, r.Unit = row[3], row[4], row[5], row[6], row[7]
+	if r.Value, err = strconv.ParseFloat(row[8], 64); err != nil {
+		return r, fmt.Errorf("invalid value: %w", err)
+	}
+	if row[9] != "" {
+		if err = json.Unmarshal([]byte(row[9]), &r.Tags); err != nil {
+			return r, fmt.Errorf("invalid tags: %w", err)
+		}
+	}
+	if r.Heartbeat, err = strconv.ParseBool(row[10]); err != nil {
+		return r, fmt.Errorf("invalid heartbeat: %w", err)
+	}
+	if r.SensorTime, err = time.Parse(time.RFC3339Nano, row[11]); err != nil {
+		return r, fmt.Errorf("invalid sensor_time: %w", err)
+	}
+	if row[12] != "" {
+		polledAt, err := time.Parse(time.RFC3339Nano, row[12])
+		if err != nil {
+			return r, fmt.Errorf("invalid polled_at: %w", err)
+		}
+		r.PolledAt = &polledAt
+	}
+	if row[13] != "" {
+		age, err := strconv.ParseFloat(row[13], 64)
+		if err != nil {
+			return r, fmt.Errorf("invalid age_seconds: %w", err)
+		}
+		r.AgeSeconds = &age
+	}
+
+	return r, nil
+}
+
+// File is a recorder that appends points to a CSV or JSON Lines file.
+// The file is rotated when it reaches MaxSize bytes or is older than
+// Rotate, rotated files are optionally gzipped.
+type File struct {
+	path     string
+	format   string
+	maxSize  int64
+	rotate   time.Duration
+	compress bool
+	now      func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewFileRecorder creates a file recorder writing to path in format,
+// csv or jsonl. Zero maxSize or rotate disable the rotation by size or
+// time.
+func NewFileRecorder(path string, format string, maxSize int64, rotate time.Duration, compress bool) (*File, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file path is not set")
+	}
+
+	format = strings.ToLower(format)
+	if format == "" {
+		format = FormatJSONL
+	}
+	if format != FormatCSV && format != FormatJSONL {
+		return nil, fmt.Errorf("invalid file format %q, must be %s or %s", format, FormatCSV, FormatJSONL)
+	}
+
+	return &File{path: path, format: format, maxSize: maxSize, rotate: rotate, compress: compress, now: time.Now}, nil
+}
+
+func (f *File) Add(datapoints []monitor.DeviceDataPoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, dp := range datapoints {
+		record, err := f.encode(NewFileRecord(dp))
+		if err == nil {
+			err = f.write(record)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Open opens the file checking it can be written.
+func (f *File) Open() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		return nil
+	}
+
+	if err := f.open(); err != nil {
+		return fmt.Errorf("could not open %s: %w", f.path, err)
+	}
+
+	return nil
+}
+
+// Flush commits the written records to disk.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *File) encode(r FileRecord) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if f.format == FormatJSONL {
+		err := json.NewEncoder(&buf).Encode(r)
+		return buf.Bytes(), err
+	}
+
+	w := csv.NewWriter(&buf)
+	if err := w.Write(r.CSV()); err != nil {
+		return nil, err
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// write appends the record rotating the file first when needed.
+func (f *File) write(record []byte) error {
+	if f.file != nil && f.size > 0 {
+		bySize := f.maxSize > 0 && f.size+int64(len(record)) > f.maxSize
+		byTime := f.rotate > 0 && f.now().Sub(f.opened) >= f.rotate
+		if bySize || byTime {
+			if err := f.rotateFile(); err != nil {
+				return fmt.Errorf("could not rotate %s: %w", f.path, err)
+			}
+		}
+	}
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return fmt.Errorf("could not open %s: %w", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(record)
+	f.size += int64(n)
+
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+
+	if f.size == 0 && f.format == FormatCSV {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		err := w.Write(FileColumns)
+		if err == nil {
+			w.Flush()
+			err = w.Error()
+		}
+		if err != nil {
+			f.file.Close()
+			f.file = nil
+			return err
+		}
+
+		n, err := f.file.Write(buf.Bytes())
+		f.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotateFile closes the file and renames it with the rotation time, for
+// instance readings.jsonl to readings-20240301T100000.jsonl.
+func (f *File) rotateFile() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	base := fmt.Sprintf("%s-%s", strings.TrimSuffix(f.path, ext), f.now().UTC().Format("20060102T150405"))
+	rotated := base + ext
+	// Keep files rotated within the same second
+	for i := 1; exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+
+	if f.compress {
+		return gzipFile(rotated)
+	}
+
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile replaces the file by its gzipped version.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func filePoints() []monitor.DeviceDataPoint {
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	return []monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: `Kitchen, "main"`, Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts, SensorTime: ts},
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts.Add(time.Hour), SensorTime: ts, Heartbeat: true, PolledAt: ts.Add(time.Hour), Age: time.Hour},
+		{Key: monitor.SensorStaleMeasurement, DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts, SensorTime: ts, Tags: map[string]string{"attribute": "temperature"}},
+	}
+}
+
+func TestFile_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readings.csv")
+	f, err := NewFileRecorder(path, "csv", 0, 0, false)
+	require.NoError(t, err)
+
+	points := filePoints()
+	require.NoError(t, f.Add(points[:1]))
+	require.NoError(t, f.Add(points[1:]))
+
+	in, err := os.Open(path)
+	require.NoError(t, err)
+	defer in.Close()
+
+	rows, err := csv.NewReader(in).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, FileColumns, rows[0], "header is written once")
+
+	for i, row := range rows[1:] {
+		r, err := ParseFileRecordCSV(row)
+		require.NoError(t, err)
+		assert.Equal(t, points[i], r.Point())
+	}
+}
+
+func TestFile_JSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readings.jsonl")
+	f, err := NewFileRecorder(path, "jsonl", 0, 0, false)
+	require.NoError(t, err)
+
+	points := filePoints()
+	require.NoError(t, f.Add(points))
+
+	in, err := os.Open(path)
+	require.NoError(t, err)
+	defer in.Close()
+
+	got := []monitor.DeviceDataPoint{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var r FileRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		got = append(got, r.Point())
+	}
+	assert.Equal(t, points, got)
+}
+
+func TestFile_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "readings.jsonl")
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	f, err := NewFileRecorder(path, "jsonl", 600, 24*time.Hour, true)
+	require.NoError(t, err)
+	f.now = func() time.Time { return now }
+
+	points := filePoints()
+	// A record is a bit over 300 bytes, the third one exceeds the size
+	require.NoError(t, f.Add(points[:1]))
+	require.NoError(t, f.Add(points[:1]))
+	require.NoError(t, f.Add(points[:1]))
+	// A day later the file is rotated regardless of its size
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, f.Add(points[:1]))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"readings-20240301T100000.jsonl.gz", "readings-20240302T100000.jsonl.gz", "readings.jsonl"}, names)
+
+	gz, err := os.Open(filepath.Join(dir, names[0]))
+	require.NoError(t, err)
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	require.NoError(t, err)
+
+	lines := 0
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestNewFileRecorder_InvalidFormat(t *testing.T) {
+	_, err := NewFileRecorder("readings.xml", "xml", 0, 0, false)
+	assert.Error(t, err)
+}
+
+func TestFile_Conformance(t *testing.T) {
+	var path string
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			path = filepath.Join(t.TempDir(), "readings.jsonl")
+			db, err := NewFileRecorder(path, FormatJSONL, 0, 0, false)
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int {
+			b, _ := os.ReadFile(path)
+			return bytes.Count(b, []byte("\n"))
+		},
+	})
+}
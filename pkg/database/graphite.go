@@ -0,0 +1,232 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+)
+
+// Default Graphite path templates for dotted paths and tagged series.
+const (
+	DefaultGraphiteTemplate       = "smartthings.{room}.{device}.{capability}.{attribute}"
+	DefaultGraphiteTaggedTemplate = "smartthings.{attribute}"
+)
+
+// Graphite is a recorder that writes points over TCP with the Graphite
+// plaintext protocol, either as dotted paths or as tagged series.
+type Graphite struct {
+	address  string
+	template string
+	tagged   bool
+	timeout  time.Duration
+	attempts uint
+	delay    time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGraphiteClient creates a Graphite recorder sending to address,
+// host:port. Template placeholders {room}, {device}, {device_id},
+// {component}, {capability} and {attribute} are replaced by sanitized
+// point values. When tagged is set, series are sent with the Graphite tag
+// syntax naming them by the template.
+func NewGraphiteClient(address string, template string, tagged bool) (*Graphite, error) {
+	address = strings.TrimPrefix(address, "tcp://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid graphite address %q: %w", address, err)
+	}
+
+	if template == "" {
+		template = DefaultGraphiteTemplate
+		if tagged {
+			template = DefaultGraphiteTaggedTemplate
+		}
+	}
+
+	return &Graphite{
+		address:  address,
+		template: template,
+		tagged:   tagged,
+		timeout:  10 * time.Second,
+		attempts: 5,
+		delay:    time.Second,
+	}, nil
+}
+
+func (db *Graphite) Add(datapoints []monitor.DeviceDataPoint) error {
+	if len(datapoints) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, dp := range datapoints {
+		buf.WriteString(db.Line(dp))
+		buf.WriteByte('\n')
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Reconnect with exponential backoff when the connection is lost
+	err := retry.Do(func() error {
+		result := db.write(buf.Bytes())
+		if result != nil {
+			log.Printf("error writing to graphite, will reconnect: %v", result)
+		}
+		return result
+	}, retry.Attempts(db.attempts), retry.Delay(db.delay), retry.LastErrorOnly(true))
+	if err != nil {
+		return fmt.Errorf("could not write to graphite at %s: %w", db.address, err)
+	}
+
+	return nil
+}
+
+// Open connects to Graphite.
+func (db *Graphite) Open() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.dial()
+	if err != nil {
+		return fmt.Errorf("could not connect to graphite at %s: %w", db.address, err)
+	}
+
+	return nil
+}
+
+func (db *Graphite) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.conn == nil {
+		return nil
+	}
+
+	err := db.conn.Close()
+	db.conn = nil
+
+	return err
+}
+
+func (db *Graphite) dial() error {
+	if db.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", db.address, db.timeout)
+	if err != nil {
+		return err
+	}
+	db.conn = conn
+
+	return nil
+}
+
+func (db *Graphite) write(lines []byte) error {
+	if err := db.dial(); err != nil {
+		return err
+	}
+
+	err := db.conn.SetWriteDeadline(time.Now().Add(db.timeout))
+	if err == nil {
+		_, err = db.conn.Write(lines)
+	}
+	if err != nil {
+		// The connection is dialed again when retried
+		db.conn.Close()
+		db.conn = nil
+	}
+
+	return err
+}
+
+// Line returns the plaintext protocol line of a point.
+func (db *Graphite) Line(dp monitor.DeviceDataPoint) string {
+	room := dp.Room
+	if room == "" {
+		room = "unassigned"
+	}
+
+	path := strings.NewReplacer(
+		"{room}", graphiteSegment(room),
+		"{device}", graphiteSegment(dp.Device),
+		"{device_id}", dp.DeviceId.String(),
+		"{component}", graphiteSegment(dp.Component),
+		"{capability}", graphiteSegment(dp.Capability),
+		"{attribute}", graphiteSegment(dp.Key),
+	).Replace(db.template)
+
+	keys := make([]string, 0, len(dp.Tags))
+	for k := range dp.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if db.tagged {
+		tags := map[string]string{
+			"device":     dp.Device,
+			"device_id":  dp.DeviceId.String(),
+			"room":       dp.Room,
+			"component":  dp.Component,
+			"capability": dp.Capability,
+			"unit":       dp.Unit,
+		}
+		for _, k := range keys {
+			tags[k] = dp.Tags[k]
+		}
+
+		names := make([]string, 0, len(tags))
+		for k := range tags {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			// Graphite does not accept empty tag values
+			if v := graphiteTagValue(tags[k]); v != "" {
+				path += ";" + graphiteSegment(k) + "=" + v
+			}
+		}
+	} else {
+		// Events on attributes, such as stale sensors, keep a path per tag
+		for _, k := range keys {
+			path += "." + graphiteSegment(dp.Tags[k])
+		}
+	}
+
+	return path + " " + strconv.FormatFloat(dp.Value, 'f', -1, 64) + " " + strconv.FormatInt(dp.Timestamp.Unix(), 10)
+}
+
+// graphiteSegment replaces the characters not allowed in a path segment.
+func graphiteSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// graphiteTagValue replaces the characters not allowed in a tag value.
+func graphiteTagValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == ';' || r == ' ' || r == '\t' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, s)
+
+	// Values can not start with a tilde
+	return strings.TrimLeft(s, "~")
+}
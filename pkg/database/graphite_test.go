@@ -0,0 +1,143 @@
+package database
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphite_Line(t *testing.T) {
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	reading := monitor.DeviceDataPoint{Key: "temperature", DeviceId: id, Device: "Kitchen Sensor 1.2", Room: "Living room", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts}
+	stale := monitor.DeviceDataPoint{Key: monitor.SensorStaleMeasurement, DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts, Tags: map[string]string{"attribute": "temperature"}}
+
+	tests := []struct {
+		name     string
+		template string
+		tagged   bool
+		dp       monitor.DeviceDataPoint
+		want     string
+	}{
+		{name: "default path", dp: reading, want: "smartthings.Living_room.Kitchen_Sensor_1_2.temperatureMeasurement.temperature 21.5 1709287200"},
+		{name: "custom path", template: "home.{device_id}.{component}.{attribute}", dp: reading, want: "home.9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5.main.temperature 21.5 1709287200"},
+		{name: "event path", dp: stale, want: "smartthings.unassigned.Kitchen.temperatureMeasurement.sensorStale.temperature 1 1709287200"},
+		{
+			name:   "tagged",
+			tagged: true,
+			dp:     reading,
+			want:   "smartthings.temperature;capability=temperatureMeasurement;component=main;device=Kitchen_Sensor_1.2;device_id=9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5;room=Living_room;unit=C 21.5 1709287200",
+		},
+		{
+			name:   "tagged event",
+			tagged: true,
+			dp:     stale,
+			want:   "smartthings.sensorStale;attribute=temperature;capability=temperatureMeasurement;component=main;device=Kitchen;device_id=9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5 1 1709287200",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewGraphiteClient("localhost:2003", tt.template, tt.tagged)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, db.Line(tt.dp))
+		})
+	}
+}
+
+func TestGraphite_Reconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	db, err := NewGraphiteClient("tcp://"+l.Addr().String(), "st.{attribute}", false)
+	require.NoError(t, err)
+	db.delay = time.Millisecond
+
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{{Key: "temperature", Value: 20, Timestamp: ts}}))
+
+	// A lost connection is dialed again
+	db.conn.Close()
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{{Key: "temperature", Value: 21, Timestamp: ts.Add(time.Minute)}}))
+
+	for _, want := range []string{"st.temperature 20 1709287200", "st.temperature 21 1709287260"} {
+		select {
+		case got := <-lines:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("did not receive %q", want)
+		}
+	}
+}
+
+func TestNewGraphiteClient_InvalidAddress(t *testing.T) {
+	_, err := NewGraphiteClient("graphite", "", false)
+	assert.Error(t, err)
+}
+
+func TestGraphite_Conformance(t *testing.T) {
+	var mu sync.Mutex
+	var lines int
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			t.Cleanup(func() { l.Close() })
+
+			mu.Lock()
+			lines = 0
+			mu.Unlock()
+			go func() {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						scanner := bufio.NewScanner(conn)
+						for scanner.Scan() {
+							mu.Lock()
+							lines++
+							mu.Unlock()
+						}
+					}()
+				}
+			}()
+
+			db, err := NewGraphiteClient(l.Addr().String(), "", false)
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int {
+			mu.Lock()
+			defer mu.Unlock()
+			return lines
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/avast/retry-go"
+)
+
+// poster posts payloads to an HTTP endpoint retrying failures. Recorders
+// writing over HTTP embed it.
+type poster struct {
+	client   *http.Client
+	attempts uint
+	delay    time.Duration
+}
+
+func newPoster(timeout time.Duration) poster {
+	return poster{
+		client:   &http.Client{Timeout: timeout},
+		attempts: 10,
+		delay:    100 * time.Millisecond,
+	}
+}
+
+// post posts body to url with the headers and returns the response body.
+// Client errors other than rate limiting are not retried as they will not
+// succeed on retry. name is the endpoint in logs and errors.
+func (p poster) post(name string, url string, body []byte, header http.Header) ([]byte, error) {
+	var answer []byte
+
+	err := retry.Do(func() error {
+		result, err := p.send(name, url, body, header)
+		if err != nil {
+			log.Printf("error writing to %s, will retry: %v", name, err)
+			return err
+		}
+		answer = result
+
+		return nil
+	}, retry.Attempts(p.attempts), retry.Delay(p.delay), retry.LastErrorOnly(true))
+
+	return answer, err
+}
+
+func (p poster) send(name string, url string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, retry.Unrecoverable(err)
+	}
+
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("User-Agent", "smartthings-influx")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s answered %s: %s", name, resp.Status, bytes.TrimSpace(msg))
+
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, retry.Unrecoverable(err)
+	}
+
+	return nil, err
+}
@@ -1,8 +1,12 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/avast/retry-go"
 	"github.com/eargollo/smartthings-influx/pkg/monitor"
@@ -10,12 +14,32 @@ import (
 	influxcli "github.com/influxdata/influxdb/client/v2"
 )
 
+// InfluxProvisioning sets what is created when opening an InfluxDB
+// recorder finds it missing.
+type InfluxProvisioning struct {
+	// Create creates the bucket, database or retention policy when missing
+	Create bool
+	// Retention is how long created buckets and retention policies keep
+	// data, zero keeps it forever
+	Retention time.Duration
+	// RetentionPolicy is the InfluxDB 1 retention policy written to, the
+	// database default one when empty
+	RetentionPolicy string
+}
+
+// influxStartAttempts is how many seconds opening waits for InfluxDB to
+// answer.
+const influxStartAttempts = 30
+
 type InfluxDB struct {
-	client   influxcli.HTTPClient
-	database string
+	client       influxcli.HTTPClient
+	url          string
+	user         string
+	database     string
+	provisioning InfluxProvisioning
 }
 
-func NewInfluxDBClient(url, user, password, database string) (*InfluxDB, error) {
+func NewInfluxDBClient(url, user, password, database string, provisioning InfluxProvisioning) (*InfluxDB, error) {
 	c, err := influxcli.NewHTTPClient(client.HTTPConfig{
 		Addr:     url,
 		Username: user,
@@ -26,13 +50,14 @@ func NewInfluxDBClient(url, user, password, database string) (*InfluxDB, error)
 		return nil, fmt.Errorf("could not instantiate http client for influx: %v", err)
 	}
 
-	return &InfluxDB{client: c, database: database}, nil
+	return &InfluxDB{client: c, url: url, user: user, database: database, provisioning: provisioning}, nil
 }
 
 func (db InfluxDB) Add(datapoints []monitor.DeviceDataPoint) error {
 	bp, err := influxcli.NewBatchPoints(influxcli.BatchPointsConfig{
-		Database:  db.database,
-		Precision: "s",
+		Database:        db.database,
+		RetentionPolicy: db.provisioning.RetentionPolicy,
+		Precision:       "s",
 	})
 	if err != nil {
 		return fmt.Errorf("could not initialize points batch: %v", err)
@@ -42,15 +67,8 @@ func (db InfluxDB) Add(datapoints []monitor.DeviceDataPoint) error {
 		// Create point
 		point, err := influxcli.NewPoint(
 			dp.Key,
-			map[string]string{
-				"device":     dp.Device,
-				"component":  dp.Component,
-				"capability": dp.Capability,
-				"unit":       dp.Unit,
-			},
-			map[string]interface{}{
-				"value": dp.Value,
-			},
+			pointTags(dp),
+			pointFields(dp),
 			dp.Timestamp,
 		)
 		if err != nil {
@@ -77,3 +95,141 @@ func (db InfluxDB) Add(datapoints []monitor.DeviceDataPoint) error {
 
 	return nil
 }
+
+// Open checks the InfluxDB server answers and the database and retention
+// policy exist, creating them when provisioning says so.
+func (db InfluxDB) Open() error {
+	err := waitInflux(func() error {
+		_, _, err := db.client.Ping(10 * time.Second)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not reach influx at %s, check the url and that the server is up: %w", db.url, err)
+	}
+
+	if db.database == "" {
+		return &monitor.ConfigError{Err: fmt.Errorf("influx database is not set")}
+	}
+
+	databases, err := db.names("SHOW DATABASES", "")
+	if err != nil {
+		return influxError(fmt.Errorf("could not list influx databases as user %q, check the user and password: %w", db.user, err))
+	}
+
+	if !databases[db.database] {
+		if !db.provisioning.Create {
+			return &monitor.ConfigError{Err: fmt.Errorf("influx database %q not found, create it or set create: true to have it created", db.database)}
+		}
+
+		stmt := "CREATE DATABASE " + quoteIdent(db.database)
+		if db.provisioning.RetentionPolicy == "" && db.provisioning.Retention > 0 {
+			stmt += " WITH DURATION " + influxDuration(db.provisioning.Retention)
+		}
+		if err := db.exec(stmt); err != nil {
+			return influxError(fmt.Errorf("could not create influx database %q, the user needs admin privileges: %w", db.database, err))
+		}
+		log.Printf("Created influx database %s", db.database)
+	}
+
+	rp := db.provisioning.RetentionPolicy
+	if rp == "" {
+		return nil
+	}
+
+	policies, err := db.names("SHOW RETENTION POLICIES ON "+quoteIdent(db.database), db.database)
+	if err != nil {
+		return influxError(fmt.Errorf("could not list retention policies of influx database %q: %w", db.database, err))
+	}
+
+	if !policies[rp] {
+		if !db.provisioning.Create {
+			return &monitor.ConfigError{Err: fmt.Errorf("retention policy %q not found on influx database %q, create it or set create: true to have it created", rp, db.database)}
+		}
+
+		stmt := fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1", quoteIdent(rp), quoteIdent(db.database), influxDuration(db.provisioning.Retention))
+		if err := db.exec(stmt); err != nil {
+			return influxError(fmt.Errorf("could not create retention policy %q on influx database %q, the user needs admin privileges: %w", rp, db.database, err))
+		}
+		log.Printf("Created influx retention policy %s on %s", rp, db.database)
+	}
+
+	return nil
+}
+
+// waitInflux pings InfluxDB until it answers, it may be starting along
+// with the monitor.
+func waitInflux(ping func() error) error {
+	return retry.Do(func() error {
+		err := ping()
+		if err != nil {
+			log.Printf("influx is not answering, will retry: %v", err)
+		}
+		return err
+	}, retry.Attempts(influxStartAttempts), retry.Delay(time.Second), retry.DelayType(retry.FixedDelay), retry.LastErrorOnly(true))
+}
+
+// influxError is a ConfigError for the errors of queries influx answered,
+// such as an authentication failure, as retrying them fails the same.
+// Errors reaching influx are kept as they are so they are retried.
+func influxError(err error) error {
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return err
+	}
+
+	return &monitor.ConfigError{Err: err}
+}
+
+// names returns the values of the first column of the query results.
+func (db InfluxDB) names(query string, database string) (map[string]bool, error) {
+	resp, err := db.client.Query(influxcli.NewQuery(query, database, ""))
+	if err == nil {
+		err = resp.Error()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, result := range resp.Results {
+		for _, series := range result.Series {
+			for _, values := range series.Values {
+				if len(values) > 0 {
+					if name, ok := values[0].(string); ok {
+						names[name] = true
+					}
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (db InfluxDB) exec(stmt string) error {
+	resp, err := db.client.Query(influxcli.NewQuery(stmt, "", ""))
+	if err == nil {
+		err = resp.Error()
+	}
+
+	return err
+}
+
+// quoteIdent quotes an InfluxQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// influxDuration formats a retention duration in InfluxQL, zero is
+// forever.
+func influxDuration(d time.Duration) string {
+	if d <= 0 {
+		return "INF"
+	}
+
+	return fmt.Sprintf("%ds", int64(d.Seconds()))
+}
+
+func (db InfluxDB) Close() error {
+	return db.client.Close()
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lineServer is a line protocol endpoint stand-in counting the lines
+// written to path. It answers pings as InfluxDB does and serves the other
+// routes with handlers.
+type lineServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	lines  int
+	params []string
+}
+
+func newLineServer(t *testing.T, path string, handlers map[string]http.HandlerFunc) *lineServer {
+	s := &lineServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := handlers[r.URL.Path]; ok {
+			h(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case path:
+			body, _ := io.ReadAll(r.Body)
+			s.mu.Lock()
+			s.lines += bytes.Count(bytes.TrimSpace(body), []byte("\n")) + 1
+			s.params = append(s.params, r.URL.RawQuery)
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *lineServer) written(*testing.T) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lines
+}
+
+// influxV1 is an InfluxDB 1 stand-in answering the queries run when
+// opening the recorder.
+type influxV1 struct {
+	*lineServer
+	password  string
+	databases map[string][]string
+	queries   []string
+}
+
+func newInfluxV1(t *testing.T, databases map[string][]string) *influxV1 {
+	db := &influxV1{password: "password", databases: databases}
+	db.lineServer = newLineServer(t, "/write", map[string]http.HandlerFunc{"/query": db.query})
+
+	return db
+}
+
+func (db *influxV1) query(w http.ResponseWriter, r *http.Request) {
+	if _, password, _ := r.BasicAuth(); password != db.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"authorization failed"}`))
+		return
+	}
+
+	q := r.FormValue("q")
+	db.mu.Lock()
+	db.queries = append(db.queries, q)
+	db.mu.Unlock()
+
+	values := [][]any{}
+	switch {
+	case q == "SHOW DATABASES":
+		for name := range db.databases {
+			values = append(values, []any{name})
+		}
+	case strings.HasPrefix(q, "SHOW RETENTION POLICIES ON "):
+		for _, name := range db.databases[strings.Trim(strings.TrimPrefix(q, "SHOW RETENTION POLICIES ON "), `"`)] {
+			values = append(values, []any{name, "0s", "168h0m0s", 1, true})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"results": []any{map[string]any{"statement_id": 0, "series": []any{map[string]any{"columns": []string{"name"}, "values": values}}}},
+	})
+}
+
+func TestInfluxDB_Open(t *testing.T) {
+	tests := []struct {
+		name         string
+		databases    map[string][]string
+		password     string
+		provisioning InfluxProvisioning
+		wantQueries  []string
+		wantErr      string
+	}{
+		{
+			name:        "database exists",
+			databases:   map[string][]string{"smartthings": {"autogen"}},
+			wantQueries: []string{"SHOW DATABASES"},
+		},
+		{
+			name:        "missing database",
+			databases:   map[string][]string{"_internal": {"monitor"}},
+			wantQueries: []string{"SHOW DATABASES"},
+			wantErr:     `influx database "smartthings" not found, create it or set create: true`,
+		},
+		{
+			name:         "database created",
+			databases:    map[string][]string{},
+			provisioning: InfluxProvisioning{Create: true, Retention: 30 * 24 * time.Hour},
+			wantQueries:  []string{"SHOW DATABASES", `CREATE DATABASE "smartthings" WITH DURATION 2592000s`},
+		},
+		{
+			name:         "missing retention policy",
+			databases:    map[string][]string{"smartthings": {"autogen"}},
+			provisioning: InfluxProvisioning{RetentionPolicy: "one_year"},
+			wantQueries:  []string{"SHOW DATABASES", `SHOW RETENTION POLICIES ON "smartthings"`},
+			wantErr:      `retention policy "one_year" not found on influx database "smartthings", create it or set create: true`,
+		},
+		{
+			name:         "database and retention policy created",
+			databases:    map[string][]string{},
+			provisioning: InfluxProvisioning{Create: true, Retention: 365 * 24 * time.Hour, RetentionPolicy: "one_year"},
+			wantQueries: []string{
+				"SHOW DATABASES",
+				`CREATE DATABASE "smartthings"`,
+				`SHOW RETENTION POLICIES ON "smartthings"`,
+				`CREATE RETENTION POLICY "one_year" ON "smartthings" DURATION 31536000s REPLICATION 1`,
+			},
+		},
+		{
+			name:      "wrong password",
+			databases: map[string][]string{"smartthings": {"autogen"}},
+			password:  "wrong",
+			wantErr:   `could not list influx databases as user "user", check the user and password`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfluxV1(t, tt.databases)
+			password := tt.password
+			if password == "" {
+				password = srv.password
+			}
+
+			db, err := NewInfluxDBClient(srv.URL, "user", password, "smartthings", tt.provisioning)
+			require.NoError(t, err)
+
+			err = db.Open()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.True(t, monitor.IsConfigError(err), "settings errors stop the monitor")
+			} else {
+				require.NoError(t, err)
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			assert.Equal(t, tt.wantQueries, srv.queries)
+		})
+	}
+}
+
+func TestInfluxDB_RetentionPolicy(t *testing.T) {
+	srv := newInfluxV1(t, map[string][]string{"smartthings": {"autogen", "one_year"}})
+
+	db, err := NewInfluxDBClient(srv.URL, "user", "password", "smartthings", InfluxProvisioning{RetentionPolicy: "one_year"})
+	require.NoError(t, err)
+	require.NoError(t, db.Open())
+	require.NoError(t, db.Add(recordertest.Points()))
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	require.Len(t, srv.params, 1)
+	assert.Contains(t, srv.params[0], "rp=one_year")
+}
+
+func TestInfluxDB_Conformance(t *testing.T) {
+	var srv *influxV1
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			srv = newInfluxV1(t, map[string][]string{"smartthings": {"autogen"}})
+			db, err := NewInfluxDBClient(srv.URL, "user", "password", "smartthings", InfluxProvisioning{})
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int { return srv.written(t) },
+	})
+}
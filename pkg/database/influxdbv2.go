@@ -1,20 +1,33 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/eargollo/smartthings-influx/pkg/monitor"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
 )
 
 type InfluxDBv2 struct {
-	client    influxdb2.Client
-	write_api api.WriteAPIBlocking
+	client       influxdb2.Client
+	write_api    api.WriteAPIBlocking
+	org          string
+	bucket       string
+	provisioning InfluxProvisioning
 }
 
-func NewInfluxDBv2Client(url string, token string, org string, bucket string) (*InfluxDBv2, error) {
+func NewInfluxDBv2Client(url string, token string, org string, bucket string, provisioning InfluxProvisioning) (*InfluxDBv2, error) {
 	c := influxdb2.NewClient(url, token)
 	if c == nil {
 		return nil, fmt.Errorf("could not instantiate client for influx")
@@ -25,7 +38,7 @@ func NewInfluxDBv2Client(url string, token string, org string, bucket string) (*
 		return nil, fmt.Errorf("could not instantiate write api for influx")
 	}
 
-	return &InfluxDBv2{client: c, write_api: w}, nil
+	return &InfluxDBv2{client: c, write_api: w, org: org, bucket: bucket, provisioning: provisioning}, nil
 }
 
 func (db InfluxDBv2) Add(datapoints []monitor.DeviceDataPoint) error {
@@ -33,15 +46,8 @@ func (db InfluxDBv2) Add(datapoints []monitor.DeviceDataPoint) error {
 		// Create point
 		point := influxdb2.NewPoint(
 			dp.Key,
-			map[string]string{
-				"device":     dp.Device,
-				"component":  dp.Component,
-				"capability": dp.Capability,
-				"unit":       dp.Unit,
-			},
-			map[string]interface{}{
-				"value": dp.Value,
-			},
+			pointTags(dp),
+			pointFields(dp),
 			dp.Timestamp,
 		)
 		if point == nil {
@@ -58,3 +64,161 @@ func (db InfluxDBv2) Add(datapoints []monitor.DeviceDataPoint) error {
 
 	return nil
 }
+
+// Open checks the InfluxDB server answers and the bucket exists, creating
+// it when provisioning says so.
+func (db InfluxDBv2) Open() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	err := waitInflux(func() error {
+		ok, err := db.client.Ping(ctx)
+		if err == nil && !ok {
+			err = fmt.Errorf("server is not ready")
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not reach influx at %s, check the url and that the server is up: %w", db.client.ServerURL(), err)
+	}
+
+	if db.org == "" || db.bucket == "" {
+		return &monitor.ConfigError{Err: fmt.Errorf("influx org and bucket must be set")}
+	}
+
+	buckets, err := db.buckets(ctx, db.bucket)
+	if err != nil {
+		return db.apiError(err, "could not look up bucket %q", db.bucket)
+	}
+
+	if len(buckets) > 0 {
+		return nil
+	}
+
+	// Buckets the token can't read are not listed, every organization has
+	// system buckets so an empty list means the token can't read buckets
+	readable, err := db.buckets(ctx, "")
+	if err != nil {
+		return db.apiError(err, "could not look up buckets")
+	}
+	if len(readable) == 0 {
+		log.Printf("WARNING: could not check influx bucket %q exists, the token can't read the buckets of organization %q. Give it read:buckets to have it checked or created.", db.bucket, db.org)
+		return nil
+	}
+
+	if !db.provisioning.Create {
+		return &monitor.ConfigError{Err: fmt.Errorf("influx bucket %q not found in organization %q, create it or set create: true to have it created", db.bucket, db.org)}
+	}
+
+	var orgs domain.Organizations
+	err = db.api(ctx, http.MethodGet, "orgs", url.Values{"org": {db.org}}, nil, &orgs)
+	if err != nil {
+		return db.apiError(err, "could not look up organization %q", db.org)
+	}
+	if orgs.Orgs == nil || len(*orgs.Orgs) == 0 {
+		return &monitor.ConfigError{Err: fmt.Errorf("influx organization %q not found, check the org name", db.org)}
+	}
+
+	bucket := domain.Bucket{
+		Name:           db.bucket,
+		OrgID:          (*orgs.Orgs)[0].Id,
+		RetentionRules: domain.RetentionRules{{EverySeconds: int64(db.provisioning.Retention.Seconds())}},
+	}
+	err = db.api(ctx, http.MethodPost, "buckets", nil, bucket, nil)
+	if err != nil {
+		return db.apiError(err, "could not create bucket %q", db.bucket)
+	}
+	log.Printf("Created influx bucket %s in organization %s", db.bucket, db.org)
+
+	return nil
+}
+
+// buckets returns the buckets of the organization with the name, or all
+// of them when name is empty, among the ones the token can read.
+func (db InfluxDBv2) buckets(ctx context.Context, name string) ([]domain.Bucket, error) {
+	query := url.Values{"org": {db.org}}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var buckets domain.Buckets
+	err := db.api(ctx, http.MethodGet, "buckets", query, nil, &buckets)
+	if err != nil || buckets.Buckets == nil {
+		return nil, err
+	}
+
+	return *buckets.Buckets, nil
+}
+
+// api calls the InfluxDB API through the client HTTP service, so failures
+// are *ihttp.Error with the response status.
+func (db InfluxDBv2) api(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	endpoint := db.client.HTTPService().ServerAPIURL() + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	perr := db.client.HTTPService().DoHTTPRequest(req, nil, func(resp *http.Response) error {
+		defer resp.Body.Close()
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+	if perr != nil {
+		return perr
+	}
+
+	return nil
+}
+
+// apiError explains the InfluxDB API errors caused by configuration.
+func (db InfluxDBv2) apiError(err error, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+
+	var perr *ihttp.Error
+	if !errors.As(err, &perr) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	switch perr.StatusCode {
+	case http.StatusUnauthorized:
+		err = fmt.Errorf("%s, influx rejected the token, check it is valid: %w", msg, err)
+	case http.StatusForbidden:
+		err = fmt.Errorf("%s, the token has no access to it, give it access to the buckets of organization %q: %w", msg, db.org, err)
+	case http.StatusNotFound:
+		err = fmt.Errorf("%s, organization %q not found, check the org name: %w", msg, db.org, err)
+	default:
+		err = fmt.Errorf("%s: %w", msg, err)
+	}
+
+	// Requests influx rejects fail the same when retried
+	if perr.StatusCode/100 == 4 {
+		return &monitor.ConfigError{Err: err}
+	}
+
+	return err
+}
+
+func (db InfluxDBv2) Close() error {
+	db.client.Close()
+
+	return nil
+}
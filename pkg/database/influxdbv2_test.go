@@ -0,0 +1,201 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// influxV2 is an InfluxDB 2 stand-in answering the bucket and organization
+// lookups run when opening the recorder. Like InfluxDB, buckets are not
+// listed to the write only token.
+type influxV2 struct {
+	*lineServer
+	token          string
+	writeOnlyToken string
+	org            string
+	buckets        []string
+	created        []map[string]any
+}
+
+func newInfluxV2(t *testing.T, buckets ...string) *influxV2 {
+	db := &influxV2{token: "token", writeOnlyToken: "write-only", org: "org", buckets: buckets}
+	db.lineServer = newLineServer(t, "/api/v2/write", map[string]http.HandlerFunc{
+		"/api/v2/buckets": db.handleBuckets,
+		"/api/v2/orgs":    db.handleOrgs,
+	})
+
+	return db
+}
+
+func (db *influxV2) authorized(w http.ResponseWriter, r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if auth != "Token "+db.token && auth != "Token "+db.writeOnlyToken {
+		db.reply(w, http.StatusUnauthorized, map[string]any{"code": "unauthorized", "message": "unauthorized access"})
+		return false
+	}
+
+	return true
+}
+
+func (db *influxV2) reply(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (db *influxV2) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	if !db.authorized(w, r) {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if r.Method == http.MethodPost {
+		bucket := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&bucket)
+		db.created = append(db.created, bucket)
+		db.buckets = append(db.buckets, bucket["name"].(string))
+		db.reply(w, http.StatusCreated, bucket)
+		return
+	}
+
+	if r.FormValue("org") != db.org {
+		db.reply(w, http.StatusNotFound, map[string]any{"code": "not found", "message": "organization name \"" + r.FormValue("org") + "\" not found"})
+		return
+	}
+
+	buckets := []any{}
+	for _, name := range db.buckets {
+		if r.Header.Get("Authorization") == "Token "+db.writeOnlyToken {
+			break
+		}
+		if r.FormValue("name") == "" || name == r.FormValue("name") {
+			buckets = append(buckets, map[string]any{"id": "0000000000000002", "orgID": "0000000000000001", "name": name, "retentionRules": []any{}})
+		}
+	}
+	db.reply(w, http.StatusOK, map[string]any{"buckets": buckets})
+}
+
+func (db *influxV2) handleOrgs(w http.ResponseWriter, r *http.Request) {
+	if !db.authorized(w, r) {
+		return
+	}
+
+	orgs := []any{}
+	if r.FormValue("org") == db.org {
+		orgs = append(orgs, map[string]any{"id": "0000000000000001", "name": db.org})
+	}
+	db.reply(w, http.StatusOK, map[string]any{"orgs": orgs})
+}
+
+func TestInfluxDBv2_Open(t *testing.T) {
+	tests := []struct {
+		name         string
+		buckets      []string
+		token        string
+		org          string
+		provisioning InfluxProvisioning
+		wantCreated  []map[string]any
+		wantErr      string
+	}{
+		{name: "bucket exists", buckets: []string{"smartthings"}},
+		{
+			name:    "missing bucket",
+			buckets: []string{"_monitoring"},
+			wantErr: `influx bucket "smartthings" not found in organization "org", create it or set create: true`,
+		},
+		{
+			name:         "bucket created",
+			buckets:      []string{"_monitoring"},
+			provisioning: InfluxProvisioning{Create: true, Retention: 30 * 24 * time.Hour},
+			wantCreated: []map[string]any{{
+				"name":           "smartthings",
+				"orgID":          "0000000000000001",
+				"retentionRules": []any{map[string]any{"everySeconds": float64(2592000)}},
+			}},
+		},
+		{
+			name:         "bucket created without retention",
+			buckets:      []string{"_monitoring"},
+			provisioning: InfluxProvisioning{Create: true},
+			wantCreated: []map[string]any{{
+				"name":           "smartthings",
+				"orgID":          "0000000000000001",
+				"retentionRules": []any{map[string]any{"everySeconds": float64(0)}},
+			}},
+		},
+		{
+			name:    "wrong token",
+			buckets: []string{"smartthings"},
+			token:   "wrong",
+			wantErr: "influx rejected the token, check it is valid",
+		},
+		{
+			name:    "write only token",
+			buckets: []string{"_monitoring", "smartthings"},
+			token:   "write-only",
+		},
+		{
+			name:         "write only token not creating",
+			buckets:      []string{"_monitoring"},
+			token:        "write-only",
+			provisioning: InfluxProvisioning{Create: true},
+		},
+		{
+			name:    "unknown organization",
+			buckets: []string{"smartthings"},
+			org:     "home",
+			wantErr: `organization "home" not found, check the org name`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfluxV2(t, tt.buckets...)
+			token, org := tt.token, tt.org
+			if token == "" {
+				token = srv.token
+			}
+			if org == "" {
+				org = srv.org
+			}
+
+			db, err := NewInfluxDBv2Client(srv.URL, token, org, "smartthings", tt.provisioning)
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Open()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.True(t, monitor.IsConfigError(err), "settings errors stop the monitor")
+			} else {
+				require.NoError(t, err)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			assert.Equal(t, tt.wantCreated, srv.created)
+		})
+	}
+}
+
+func TestInfluxDBv2_Conformance(t *testing.T) {
+	var srv *influxV2
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			srv = newInfluxV2(t, "bucket")
+			db, err := NewInfluxDBv2Client(srv.URL, srv.token, srv.org, "bucket", InfluxProvisioning{})
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int { return srv.written(t) },
+	})
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/influxdata/influxdb/models"
+)
+
+// udpPayloadSize is the maximum size of UDP datagrams, lines are packed
+// up to it.
+const udpPayloadSize = 512
+
+// MarshalLineProtocol serializes the data points to line protocol, one
+// line each, with the schema of the InfluxDB recorders and timestamps in
+// precision: ns, us, ms or s.
+func MarshalLineProtocol(datapoints []monitor.DeviceDataPoint, precision string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, dp := range datapoints {
+		point, err := models.NewPoint(dp.Key, models.NewTags(pointTags(dp)), pointFields(dp), dp.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("could not create point: %w", err)
+		}
+
+		buf.WriteString(point.PrecisionString(precision))
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// LineProtocol is a recorder that sends points in line protocol over
+// HTTP POST or UDP to endpoints such as VictoriaMetrics, QuestDB,
+// Telegraf listeners or InfluxDB 3.
+type LineProtocol struct {
+	poster
+	url       *url.URL
+	header    http.Header
+	precision string
+}
+
+// lineProtocolPrecisions are the supported timestamp precisions.
+var lineProtocolPrecisions = []string{"ns", "us", "ms", "s"}
+
+// NewLineProtocolClient creates a line protocol recorder sending to
+// address, a http(s):// URL receiving POST requests with headers or a
+// udp://host:port address. precision is sent as the precision query
+// parameter unless address sets it.
+func NewLineProtocolClient(address string, headers map[string]string, precision string) (*LineProtocol, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid line protocol url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "udp":
+	default:
+		return nil, fmt.Errorf("invalid line protocol url %q, must be http, https or udp", address)
+	}
+
+	if precision == "" {
+		precision = "ns"
+	}
+	if !slices.Contains(lineProtocolPrecisions, precision) {
+		return nil, fmt.Errorf("invalid line protocol precision %q, must be one of %s", precision, strings.Join(lineProtocolPrecisions, ", "))
+	}
+
+	if u.Scheme != "udp" && !u.Query().Has("precision") {
+		query := u.Query()
+		query.Set("precision", precision)
+		u.RawQuery = query.Encode()
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+
+	return &LineProtocol{
+		poster:    newPoster(30 * time.Second),
+		url:       u,
+		header:    header,
+		precision: precision,
+	}, nil
+}
+
+func (db LineProtocol) Add(datapoints []monitor.DeviceDataPoint) error {
+	if len(datapoints) == 0 {
+		return nil
+	}
+
+	body, err := MarshalLineProtocol(datapoints, db.precision)
+	if err != nil {
+		return err
+	}
+
+	if db.url.Scheme == "udp" {
+		err = db.sendUDP(body)
+	} else {
+		_, err = db.post("line protocol endpoint", db.url.String(), body, db.header)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write line protocol to %s: %w", db.url.Redacted(), err)
+	}
+
+	return nil
+}
+
+// sendUDP sends the lines packing them in datagrams of up to
+// udpPayloadSize bytes. Longer lines are sent alone.
+func (db LineProtocol) sendUDP(body []byte) error {
+	conn, err := net.Dial("udp", db.url.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var payload []byte
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+
+		if len(payload) > 0 && len(payload)+len(line) > udpPayloadSize {
+			if _, err := conn.Write(payload); err != nil {
+				return err
+			}
+			payload = payload[:0]
+		}
+		payload = append(payload, line...)
+	}
+
+	if len(payload) > 0 {
+		_, err = conn.Write(payload)
+	}
+
+	return err
+}
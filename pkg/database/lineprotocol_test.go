@@ -0,0 +1,139 @@
+package database
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lineProtocolPoints() []monitor.DeviceDataPoint {
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := LineProtocolDeviceId("Kitchen Sensor")
+
+	return []monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts, SensorTime: ts},
+		{Key: "sensorStale", DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts, SensorTime: ts, Tags: map[string]string{"attribute": "temperature"}},
+	}
+}
+
+const lineProtocolLines = `temperature,capability=temperatureMeasurement,component=main,device=Kitchen\ Sensor,unit=C value=21.5 1709287200
+sensorStale,attribute=temperature,capability=temperatureMeasurement,component=main,device=Kitchen\ Sensor value=1 1709287200
+`
+
+func TestMarshalLineProtocol(t *testing.T) {
+	got, err := MarshalLineProtocol(lineProtocolPoints(), "s")
+	require.NoError(t, err)
+	assert.Equal(t, lineProtocolLines, string(got))
+
+	// Lines read back into the same points
+	r, err := NewPointReader(bytes.NewReader(got), FormatLineProtocol, "s")
+	require.NoError(t, err)
+	assert.Equal(t, lineProtocolPoints(), readAll(t, r))
+}
+
+func TestLineProtocol_HTTP(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	db, err := NewLineProtocolClient(srv.URL+"/write?precision=s", map[string]string{"authorization": "Token secret"}, "s")
+	require.NoError(t, err)
+	require.NoError(t, db.Add(lineProtocolPoints()))
+
+	assert.Equal(t, lineProtocolLines, string(body))
+	assert.Equal(t, "Token secret", header.Get("Authorization"))
+	assert.Equal(t, "text/plain; charset=utf-8", header.Get("Content-Type"))
+}
+
+func TestLineProtocol_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	db, err := NewLineProtocolClient("udp://"+conn.LocalAddr().String(), nil, "s")
+	require.NoError(t, err)
+
+	// Enough points to need several datagrams
+	points := []monitor.DeviceDataPoint{}
+	for i := 0; i < 10; i++ {
+		dp := lineProtocolPoints()[0]
+		dp.DeviceId = uuid.New()
+		dp.Value = float64(i)
+		points = append(points, dp)
+	}
+	require.NoError(t, db.Add(points))
+
+	want, err := MarshalLineProtocol(points, "s")
+	require.NoError(t, err)
+
+	var got []byte
+	buf := make([]byte, 65536)
+	for len(got) < len(want) {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, n, udpPayloadSize)
+		got = append(got, buf[:n]...)
+	}
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestNewLineProtocolClient_InvalidURL(t *testing.T) {
+	_, err := NewLineProtocolClient("tcp://localhost:8089", nil, "")
+	assert.Error(t, err)
+}
+
+func TestNewLineProtocolClient_Precision(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		precision string
+		wantURL   string
+		wantErr   bool
+	}{
+		{name: "default", address: "http://localhost:8428/write", wantURL: "http://localhost:8428/write?precision=ns"},
+		{name: "added to url", address: "http://localhost:8428/write?db=home", precision: "ms", wantURL: "http://localhost:8428/write?db=home&precision=ms"},
+		{name: "set by url", address: "http://localhost:8428/write?precision=s", precision: "s", wantURL: "http://localhost:8428/write?precision=s"},
+		{name: "udp", address: "udp://localhost:8089", precision: "s", wantURL: "udp://localhost:8089"},
+		{name: "unknown", address: "http://localhost:8428/write", precision: "seconds", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewLineProtocolClient(tt.address, nil, tt.precision)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantURL, db.url.String())
+		})
+	}
+}
+
+func TestLineProtocol_Conformance(t *testing.T) {
+	var srv *lineServer
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			srv = newLineServer(t, "/write", nil)
+			db, err := NewLineProtocolClient(srv.URL+"/write", nil, "s")
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int { return srv.written(t) },
+	})
+}
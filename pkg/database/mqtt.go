@@ -0,0 +1,249 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// DefaultMQTTTopic is the topic template used when none is configured.
+// Components and capabilities of a device can report attributes of the
+// same name, so both are part of it.
+const DefaultMQTTTopic = "smartthings/{room}/{device}/{component}/{capability}/{attribute}"
+
+// DefaultDiscoveryPrefix is the Home Assistant MQTT discovery prefix.
+const DefaultDiscoveryPrefix = "homeassistant"
+
+// MQTTConfig configures the MQTT recorder.
+type MQTTConfig struct {
+	// Broker is the broker address, for instance tcp://localhost:1883
+	Broker   string
+	ClientID string
+	User     string
+	Password string
+	// Topic is the topic template. Placeholders {room}, {device},
+	// {device_id}, {component}, {capability} and {attribute} are replaced
+	// by the point values.
+	Topic  string
+	QoS    byte
+	Retain bool
+	// Discovery publishes Home Assistant discovery configs under
+	// DiscoveryPrefix for every new series.
+	Discovery       bool
+	DiscoveryPrefix string
+	// Timeout is how long to wait for the broker to acknowledge
+	Timeout time.Duration
+}
+
+// MQTT is a recorder that publishes points to an MQTT broker.
+type MQTT struct {
+	config    MQTTConfig
+	client    mqtt.Client
+	mu        sync.Mutex
+	announced map[string]bool
+}
+
+// MQTTPayload is the message published for each point.
+type MQTTPayload struct {
+	Value     float64           `json:"value"`
+	Unit      string            `json:"unit,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+func NewMQTTClient(config MQTTConfig) (*MQTT, error) {
+	if config.Broker == "" {
+		return nil, fmt.Errorf("mqtt broker is not set")
+	}
+
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos %d, must be 0, 1 or 2", config.QoS)
+	}
+
+	if config.Topic == "" {
+		config.Topic = DefaultMQTTTopic
+	}
+
+	if config.ClientID == "" {
+		config.ClientID = "smartthings-influx"
+	}
+
+	if config.DiscoveryPrefix == "" {
+		config.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.User).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(config.Timeout)
+
+	return &MQTT{config: config, client: mqtt.NewClient(opts), announced: make(map[string]bool)}, nil
+}
+
+func (db *MQTT) Add(datapoints []monitor.DeviceDataPoint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.connect()
+	if err != nil {
+		return err
+	}
+
+	for _, dp := range datapoints {
+		topic := db.Topic(dp)
+
+		if db.config.Discovery {
+			err := db.announce(dp, topic)
+			if err != nil {
+				return fmt.Errorf("could not publish discovery config: %w", err)
+			}
+		}
+
+		payload, err := json.Marshal(MQTTPayload{Value: dp.Value, Unit: dp.Unit, Timestamp: dp.Timestamp, Tags: dp.Tags})
+		if err != nil {
+			return fmt.Errorf("could not encode mqtt payload: %w", err)
+		}
+
+		err = db.wait(db.client.Publish(topic, db.config.QoS, db.config.Retain, payload))
+		if err != nil {
+			return fmt.Errorf("could not publish to %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *MQTT) wait(token mqtt.Token) error {
+	if !token.WaitTimeout(db.config.Timeout) {
+		return fmt.Errorf("timeout after %s", db.config.Timeout)
+	}
+
+	return token.Error()
+}
+
+// Topic returns the topic a point is published to.
+func (db *MQTT) Topic(dp monitor.DeviceDataPoint) string {
+	room := dp.Room
+	if room == "" {
+		room = "unassigned"
+	}
+
+	return strings.NewReplacer(
+		"{room}", topicSegment(room),
+		"{device}", topicSegment(dp.Device),
+		"{device_id}", dp.DeviceId.String(),
+		"{component}", topicSegment(dp.Component),
+		"{capability}", topicSegment(dp.Capability),
+		"{attribute}", topicSegment(dp.Key),
+	).Replace(db.config.Topic)
+}
+
+// topicSegment replaces the characters with special meaning in topics.
+func topicSegment(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+type discoveryDevice struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// announce publishes, once, the Home Assistant discovery config of the
+// series of the point. Configs are retained so Home Assistant finds them
+// after restarting.
+func (db *MQTT) announce(dp monitor.DeviceDataPoint, topic string) error {
+	// Events are not sensors
+	if dp.Key == monitor.InventoryChangeMeasurement || dp.Key == monitor.SensorStaleMeasurement {
+		return nil
+	}
+
+	// Segments are joined by a double underscore, which snake case never
+	// produces, so different series never share an object ID
+	objectID := strings.Join([]string{snakeCase(dp.Component), snakeCase(dp.Capability), snakeCase(dp.Key)}, "__")
+	configTopic := fmt.Sprintf("%s/sensor/%s/%s/config", db.config.DiscoveryPrefix, dp.DeviceId, objectID)
+	if db.announced[configTopic] {
+		return nil
+	}
+
+	config := discoveryConfig{
+		Name:              dp.Key,
+		UniqueID:          "smartthings_" + dp.DeviceId.String() + "_" + objectID,
+		StateTopic:        topic,
+		ValueTemplate:     "{{ value_json.value }}",
+		UnitOfMeasurement: dp.Unit,
+		Device: discoveryDevice{
+			Identifiers:   []string{"smartthings_" + dp.DeviceId.String()},
+			Name:          dp.Device,
+			Manufacturer:  "SmartThings",
+			SuggestedArea: dp.Room,
+		},
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	err = db.wait(db.client.Publish(configTopic, 1, true, payload))
+	if err != nil {
+		return err
+	}
+	db.announced[configTopic] = true
+
+	return nil
+}
+
+// Open connects to the broker.
+func (db *MQTT) Open() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.connect()
+}
+
+func (db *MQTT) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.client.IsConnected() {
+		db.client.Disconnect(250)
+	}
+
+	return nil
+}
+
+func (db *MQTT) connect() error {
+	if db.client.IsConnected() {
+		return nil
+	}
+
+	err := db.wait(db.client.Connect())
+	if err != nil {
+		return fmt.Errorf("could not connect to mqtt broker %s: %w", db.config.Broker, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type published struct {
+	topic   string
+	qos     byte
+	retain  bool
+	payload []byte
+}
+
+// broker is a minimal MQTT broker stand-in that accepts connections and
+// keeps the published messages.
+type broker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []published
+	user     string
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &broker{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.user = p.Username
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			err = ack.Write(conn)
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.messages = append(b.messages, published{topic: p.TopicName, qos: p.Qos, retain: p.Retain, payload: p.Payload})
+			b.mu.Unlock()
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				err = ack.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			err = packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *broker) published() []published {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]published{}, b.messages...)
+}
+
+func TestMQTT_Add(t *testing.T) {
+	b := newBroker(t)
+
+	db, err := NewMQTTClient(MQTTConfig{Broker: b.url(), User: "user", Password: "pass", QoS: 1, Retain: true, Discovery: true})
+	require.NoError(t, err)
+
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	point := monitor.DeviceDataPoint{Key: "temperature", DeviceId: id, Device: "Kitchen Sensor", Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts}
+
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{point}))
+	point.Value = 22
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{point}))
+
+	msgs := b.published()
+	require.Len(t, msgs, 3, "discovery config is published once")
+
+	discovery := msgs[0]
+	assert.Equal(t, "homeassistant/sensor/9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5/main__temperature_measurement__temperature/config", discovery.topic)
+	assert.True(t, discovery.retain)
+	var config discoveryConfig
+	require.NoError(t, json.Unmarshal(discovery.payload, &config))
+	assert.Equal(t, "smartthings/Kitchen/Kitchen Sensor/main/temperatureMeasurement/temperature", config.StateTopic)
+	assert.Equal(t, "smartthings_9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5_main__temperature_measurement__temperature", config.UniqueID)
+	assert.Equal(t, "C", config.UnitOfMeasurement)
+	assert.Equal(t, "Kitchen", config.Device.SuggestedArea)
+
+	for i, want := range []float64{21.5, 22} {
+		msg := msgs[i+1]
+		assert.Equal(t, "smartthings/Kitchen/Kitchen Sensor/main/temperatureMeasurement/temperature", msg.topic)
+		assert.Equal(t, byte(1), msg.qos)
+		assert.True(t, msg.retain)
+
+		var payload MQTTPayload
+		require.NoError(t, json.Unmarshal(msg.payload, &payload))
+		assert.Equal(t, MQTTPayload{Value: want, Unit: "C", Timestamp: ts}, payload)
+	}
+
+	b.mu.Lock()
+	assert.Equal(t, "user", b.user)
+	b.mu.Unlock()
+}
+
+func TestMQTT_Topic(t *testing.T) {
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	dp := monitor.DeviceDataPoint{Key: "temperature", DeviceId: id, Device: "Sensor 1/2", Component: "main", Capability: "temperatureMeasurement"}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "default", want: "smartthings/unassigned/Sensor 1_2/main/temperatureMeasurement/temperature"},
+		{name: "all placeholders", template: "st/{device_id}/{component}/{capability}/{attribute}", want: "st/9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5/main/temperatureMeasurement/temperature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewMQTTClient(MQTTConfig{Broker: "tcp://localhost:1883", Topic: tt.template})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, db.Topic(dp))
+		})
+	}
+}
+
+func TestMQTT_Conformance(t *testing.T) {
+	var b *broker
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			b = newBroker(t)
+			db, err := NewMQTTClient(MQTTConfig{Broker: b.url(), QoS: 1})
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int { return len(b.published()) },
+	})
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP protocols
+const (
+	OTLPGRPC = "grpc"
+	OTLPHTTP = "http"
+)
+
+// otlpScope is the instrumentation scope of the exported metrics.
+const otlpScope = "github.com/eargollo/smartthings-influx"
+
+// OTLP is a recorder that exports points as OpenTelemetry gauge metrics
+// to an OTLP receiver such as the OpenTelemetry Collector.
+type OTLP struct {
+	poster
+	protocol string
+	url      string
+	headers  map[string]string
+	timeout  time.Duration
+
+	conn *grpc.ClientConn
+	grpc collectorpb.MetricsServiceClient
+}
+
+// NewOTLPClient creates an OTLP recorder. For grpc the endpoint is
+// http://host:port for plain text or https://host:port for TLS. For http
+// it is the receiver URL, /v1/metrics is appended when it has no path.
+// Headers are sent with every export.
+func NewOTLPClient(endpoint string, protocol string, headers map[string]string) (*OTLP, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q, must be a http or https url", endpoint)
+	}
+
+	db := &OTLP{
+		poster:   newPoster(30 * time.Second),
+		protocol: strings.ToLower(protocol),
+		headers:  headers,
+		timeout:  30 * time.Second,
+	}
+
+	switch db.protocol {
+	case OTLPGRPC, "":
+		db.protocol = OTLPGRPC
+		creds := insecure.NewCredentials()
+		if u.Scheme == "https" {
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+
+		conn, err := grpc.NewClient(u.Host, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("could not instantiate otlp grpc client: %w", err)
+		}
+		db.conn = conn
+		db.grpc = collectorpb.NewMetricsServiceClient(conn)
+	case OTLPHTTP:
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/metrics"
+		}
+		db.url = u.String()
+	default:
+		return nil, fmt.Errorf("invalid otlp protocol %q, must be %s or %s", protocol, OTLPGRPC, OTLPHTTP)
+	}
+
+	return db, nil
+}
+
+func (db OTLP) Close() error {
+	if db.conn == nil {
+		return nil
+	}
+
+	return db.conn.Close()
+}
+
+func (db OTLP) Add(datapoints []monitor.DeviceDataPoint) error {
+	if len(datapoints) == 0 {
+		return nil
+	}
+
+	req := otlpRequest(datapoints)
+
+	var resp *collectorpb.ExportMetricsServiceResponse
+	var err error
+	if db.protocol == OTLPGRPC {
+		err = retry.Do(func() error {
+			var result error
+			resp, result = db.exportGRPC(req)
+			if result != nil {
+				log.Printf("error exporting otlp metrics, will retry: %v", result)
+			}
+			return result
+		}, retry.Attempts(db.attempts), retry.Delay(db.delay), retry.LastErrorOnly(true))
+	} else {
+		resp, err = db.exportHTTP(req)
+	}
+	if err != nil {
+		return fmt.Errorf("could not export otlp metrics: %w", err)
+	}
+
+	if ps := resp.GetPartialSuccess(); ps != nil && ps.GetRejectedDataPoints() > 0 {
+		log.Printf("WARNING: otlp receiver rejected %d data points: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+
+	return nil
+}
+
+func (db OTLP) exportGRPC(req *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), db.timeout)
+	defer cancel()
+
+	if len(db.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(db.headers))
+	}
+
+	resp, err := db.grpc.Export(ctx, req)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return nil, err
+		}
+		return nil, retry.Unrecoverable(err)
+	}
+
+	return resp, nil
+}
+
+func (db OTLP) exportHTTP(req *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range db.headers {
+		header.Set(k, v)
+	}
+
+	msg, err := db.post("otlp receiver", db.url, body, header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &collectorpb.ExportMetricsServiceResponse{}
+	if err := proto.Unmarshal(msg, result); err != nil {
+		// The points were accepted even if the answer can not be read
+		log.Printf("WARNING: could not read otlp response: %v", err)
+	}
+
+	return result, nil
+}
+
+// OTLPMetricName is the name of the metric of an attribute, for
+// instance smartthings.relative_humidity for relativeHumidity.
+func OTLPMetricName(attribute string) string {
+	return "smartthings." + snakeCase(attribute)
+}
+
+// otlpRequest builds the export request with a gauge metric per attribute
+// and unit holding the points as data points.
+func otlpRequest(datapoints []monitor.DeviceDataPoint) *collectorpb.ExportMetricsServiceRequest {
+	gauges := map[string]*metricspb.Metric{}
+	names := []string{}
+
+	for _, dp := range datapoints {
+		name := OTLPMetricName(dp.Key)
+		key := name + "/" + dp.Unit
+
+		metric, ok := gauges[key]
+		if !ok {
+			metric = &metricspb.Metric{
+				Name: name,
+				Unit: dp.Unit,
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}},
+			}
+			gauges[key] = metric
+			names = append(names, key)
+		}
+
+		gauge := metric.GetGauge()
+		gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+			Attributes:   otlpAttributes(dp),
+			TimeUnixNano: uint64(dp.Timestamp.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: dp.Value},
+		})
+	}
+
+	scope := &metricspb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: otlpScope}}
+	for _, key := range names {
+		scope.Metrics = append(scope.Metrics, gauges[key])
+	}
+
+	return &collectorpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{otlpString("service.name", "smartthings-influx")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{scope},
+		}},
+	}
+}
+
+// otlpAttributes are the attributes of the data point of a point,
+// including its tags, sorted by key.
+func otlpAttributes(dp monitor.DeviceDataPoint) []*commonpb.KeyValue {
+	values := map[string]string{}
+	for k, v := range dp.Tags {
+		values[k] = v
+	}
+
+	values["device"] = dp.Device
+	values["device_id"] = dp.DeviceId.String()
+	values["component"] = dp.Component
+	values["capability"] = dp.Capability
+	values["attribute"] = pointAttribute(dp)
+	if dp.Unit != "" {
+		values["unit"] = dp.Unit
+	}
+	if dp.Room != "" {
+		values["room"] = dp.Room
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, otlpString(k, values[k]))
+	}
+
+	return attributes
+}
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
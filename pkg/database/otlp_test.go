@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver is an OTLP gRPC receiver stand-in keeping the requests.
+type otlpReceiver struct {
+	collectorpb.UnimplementedMetricsServiceServer
+	requests chan *collectorpb.ExportMetricsServiceRequest
+	headers  chan metadata.MD
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.headers <- md
+	r.requests <- req
+	return &collectorpb.ExportMetricsServiceResponse{}, nil
+}
+
+func otlpPoints() []monitor.DeviceDataPoint {
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	return []monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts},
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 22, Timestamp: ts.Add(time.Minute)},
+		{Key: "relativeHumidity", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "relativeHumidityMeasurement", Unit: "%", Value: 40, Timestamp: ts},
+	}
+}
+
+// assertOTLPRequest checks the request holds the gauges of otlpPoints.
+func assertOTLPRequest(t *testing.T, req *collectorpb.ExportMetricsServiceRequest) {
+	require.Len(t, req.ResourceMetrics, 1)
+	require.Len(t, req.ResourceMetrics[0].ScopeMetrics, 1)
+	ms := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, ms, 2)
+
+	assert.Equal(t, "smartthings.temperature", ms[0].Name)
+	assert.Equal(t, "C", ms[0].Unit)
+	dps := ms[0].GetGauge().GetDataPoints()
+	require.Len(t, dps, 2)
+	assert.Equal(t, 21.5, dps[0].GetAsDouble())
+	assert.Equal(t, uint64(otlpPoints()[0].Timestamp.UnixNano()), dps[0].TimeUnixNano)
+	assert.Equal(t, uint64(otlpPoints()[1].Timestamp.UnixNano()), dps[1].TimeUnixNano)
+
+	attributes := map[string]string{}
+	for _, kv := range dps[0].Attributes {
+		attributes[kv.Key] = kv.Value.GetStringValue()
+	}
+	assert.Equal(t, map[string]string{
+		"attribute":  "temperature",
+		"capability": "temperatureMeasurement",
+		"component":  "main",
+		"device":     "Kitchen",
+		"device_id":  "9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5",
+		"room":       "Kitchen",
+		"unit":       "C",
+	}, attributes)
+
+	assert.Equal(t, "smartthings.relative_humidity", ms[1].Name)
+	assert.IsType(t, &metricspb.Metric_Gauge{}, ms[1].Data)
+}
+
+func TestOTLP_GRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	receiver := &otlpReceiver{requests: make(chan *collectorpb.ExportMetricsServiceRequest, 1), headers: make(chan metadata.MD, 1)}
+	srv := grpc.NewServer()
+	collectorpb.RegisterMetricsServiceServer(srv, receiver)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	db, err := NewOTLPClient("http://"+l.Addr().String(), "grpc", map[string]string{"x-api-key": "secret"})
+	require.NoError(t, err)
+	require.NoError(t, db.Add(otlpPoints()))
+
+	assert.Equal(t, []string{"secret"}, (<-receiver.headers).Get("x-api-key"))
+	assertOTLPRequest(t, <-receiver.requests)
+}
+
+func TestOTLP_HTTP(t *testing.T) {
+	var path, contentType string
+	req := &collectorpb.ExportMetricsServiceRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, proto.Unmarshal(body, req))
+
+		resp, _ := proto.Marshal(&collectorpb.ExportMetricsServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	db, err := NewOTLPClient(srv.URL, "http", nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Add(otlpPoints()))
+
+	assert.Equal(t, "/v1/metrics", path)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	assertOTLPRequest(t, req)
+}
+
+func TestNewOTLPClient_Invalid(t *testing.T) {
+	_, err := NewOTLPClient("collector:4317", "grpc", nil)
+	assert.Error(t, err)
+
+	_, err = NewOTLPClient("http://collector:4317", "thrift", nil)
+	assert.Error(t, err)
+}
+
+func TestOTLP_Conformance(t *testing.T) {
+	var receiver *otlpReceiver
+	var points int
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			receiver = &otlpReceiver{requests: make(chan *collectorpb.ExportMetricsServiceRequest, 10), headers: make(chan metadata.MD, 10)}
+			points = 0
+			srv := grpc.NewServer()
+			collectorpb.RegisterMetricsServiceServer(srv, receiver)
+			go srv.Serve(l)
+			t.Cleanup(srv.Stop)
+
+			db, err := NewOTLPClient("http://"+l.Addr().String(), "grpc", nil)
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int {
+			for {
+				select {
+				case req := <-receiver.requests:
+					<-receiver.headers
+					for _, rm := range req.ResourceMetrics {
+						for _, sm := range rm.ScopeMetrics {
+							for _, m := range sm.Metrics {
+								points += len(m.GetGauge().GetDataPoints())
+							}
+						}
+					}
+				default:
+					return points
+				}
+			}
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package database
+
+import "github.com/eargollo/smartthings-influx/pkg/monitor"
+
+// pointTags are the tags of the point stored for the data point.
+func pointTags(dp monitor.DeviceDataPoint) map[string]string {
+	tags := map[string]string{
+		"device":     dp.Device,
+		"component":  dp.Component,
+		"capability": dp.Capability,
+		"unit":       dp.Unit,
+	}
+
+	for k, v := range dp.Tags {
+		tags[k] = v
+	}
+
+	return tags
+}
+
+// pointFields are the fields of the point stored for the data point.
+func pointFields(dp monitor.DeviceDataPoint) map[string]interface{} {
+	fields := map[string]interface{}{
+		"value": dp.Value,
+	}
+
+	if dp.Heartbeat {
+		fields["heartbeat"] = true
+	}
+
+	if !dp.PolledAt.IsZero() {
+		fields["polled_at"] = dp.PolledAt.Unix()
+		fields["age"] = dp.Age.Seconds()
+	}
+
+	return fields
+}
+
+// pointAttribute is the attribute a point refers to. Events on an
+// attribute, such as stale sensors, carry it in a tag.
+func pointAttribute(dp monitor.DeviceDataPoint) string {
+	if a, ok := dp.Tags["attribute"]; ok {
+		return a
+	}
+
+	return dp.Key
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresBatchSize is the maximum number of rows per insert statement.
+const postgresBatchSize = 1000
+
+// postgresMigrations are the schema changes, applied in order. Version of
+// a migration is its position starting at 1. Never change a released
+// migration, append a new one instead.
+var postgresMigrations = []string{
+	`CREATE TABLE devices (
+		device_id  uuid PRIMARY KEY,
+		label      text NOT NULL,
+		room       text NOT NULL DEFAULT '',
+		updated_at timestamptz NOT NULL
+	);
+	CREATE TABLE readings (
+		time        timestamptz NOT NULL,
+		device_id   uuid NOT NULL REFERENCES devices (device_id),
+		component   text NOT NULL,
+		capability  text NOT NULL,
+		measurement text NOT NULL,
+		tags        jsonb NOT NULL DEFAULT '{}',
+		unit        text NOT NULL DEFAULT '',
+		value       double precision NOT NULL,
+		heartbeat   boolean NOT NULL DEFAULT false,
+		polled_at   timestamptz,
+		age_seconds double precision,
+		PRIMARY KEY (device_id, component, capability, measurement, tags, time)
+	);
+	CREATE INDEX readings_time_idx ON readings (time DESC);`,
+}
+
+// readingsColumns are the columns written for each point.
+var readingsColumns = []string{"time", "device_id", "component", "capability", "measurement", "tags", "unit", "value", "heartbeat", "polled_at", "age_seconds"}
+
+// Postgres is a recorder that writes points to PostgreSQL, optionally
+// storing readings in a TimescaleDB hypertable.
+type Postgres struct {
+	pool      *pgxpool.Pool
+	timescale bool
+	mu        sync.Mutex
+	migrated  bool
+}
+
+// NewPostgresClient creates a PostgreSQL recorder. The schema is created
+// or migrated when opened or at the first write.
+func NewPostgresClient(url string, timescale bool) (*Postgres, error) {
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		return nil, fmt.Errorf("could not instantiate postgres pool: %w", err)
+	}
+
+	return &Postgres{pool: pool, timescale: timescale}, nil
+}
+
+// Open checks the connection and migrates the schema.
+func (db *Postgres) Open() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := db.pool.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	return db.migrate(ctx)
+}
+
+func (db *Postgres) Close() error {
+	db.pool.Close()
+
+	return nil
+}
+
+func (db *Postgres) Add(datapoints []monitor.DeviceDataPoint) error {
+	if len(datapoints) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	err := db.migrate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		devicesSQL, devicesArgs := devicesUpsert(datapoints)
+		if _, err := tx.Exec(ctx, devicesSQL, devicesArgs...); err != nil {
+			return fmt.Errorf("could not upsert devices: %w", err)
+		}
+
+		rows := readingsRows(datapoints)
+		for start := 0; start < len(rows); start += postgresBatchSize {
+			end := min(start+postgresBatchSize, len(rows))
+			sql, args := readingsUpsert(rows[start:end])
+			if _, err := tx.Exec(ctx, sql, args...); err != nil {
+				return fmt.Errorf("could not insert readings: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrate applies the pending migrations once per process. An advisory
+// lock keeps concurrent instances from migrating at the same time.
+func (db *Postgres) migrate(ctx context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.migrated {
+		return nil
+	}
+
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('smartthings-influx'))"); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    integer PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`)
+		if err != nil {
+			return err
+		}
+
+		var version int
+		err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		if version > len(postgresMigrations) {
+			return fmt.Errorf("database schema version %d is newer than the supported %d", version, len(postgresMigrations))
+		}
+
+		for i := version; i < len(postgresMigrations); i++ {
+			log.Printf("Applying postgres migration %d", i+1)
+			if _, err := tx.Exec(ctx, postgresMigrations[i]); err != nil {
+				return fmt.Errorf("migration %d failed: %w", i+1, err)
+			}
+			if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+				return err
+			}
+		}
+
+		if db.timescale {
+			if _, err := tx.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+				return fmt.Errorf("could not enable timescaledb: %w", err)
+			}
+			_, err := tx.Exec(ctx, "SELECT create_hypertable('readings', 'time', if_not_exists => TRUE, migrate_data => TRUE)")
+			if err != nil {
+				return fmt.Errorf("could not create readings hypertable: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not migrate postgres schema: %w", err)
+	}
+	db.migrated = true
+
+	return nil
+}
+
+// devicesUpsert returns the statement keeping the devices of the points
+// with their latest label and room.
+func devicesUpsert(datapoints []monitor.DeviceDataPoint) (string, []any) {
+	devices := map[uuid.UUID]monitor.DeviceDataPoint{}
+	ids := []uuid.UUID{}
+	for _, dp := range datapoints {
+		if _, ok := devices[dp.DeviceId]; !ok {
+			ids = append(ids, dp.DeviceId)
+		}
+		devices[dp.DeviceId] = dp
+	}
+
+	values := []string{}
+	args := []any{}
+	for _, id := range ids {
+		dp := devices[id]
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4))
+		args = append(args, id, dp.Device, dp.Room, time.Now())
+	}
+
+	return "INSERT INTO devices (device_id, label, room, updated_at) VALUES " + strings.Join(values, ", ") +
+		" ON CONFLICT (device_id) DO UPDATE SET label = EXCLUDED.label, room = EXCLUDED.room, updated_at = EXCLUDED.updated_at", args
+}
+
+// readingsRows converts the points to rows of readingsColumns. Rows of the
+// same series and time are written once, keeping the last, as a statement
+// can not update the same row twice.
+func readingsRows(datapoints []monitor.DeviceDataPoint) [][]any {
+	index := map[string]int{}
+	rows := [][]any{}
+
+	for _, dp := range datapoints {
+		tags := dp.Tags
+		if tags == nil {
+			tags = map[string]string{}
+		}
+
+		var polledAt *time.Time
+		var age *float64
+		if !dp.PolledAt.IsZero() {
+			polledAt = &dp.PolledAt
+			seconds := dp.Age.Seconds()
+			age = &seconds
+		}
+
+		row := []any{dp.Timestamp, dp.DeviceId, dp.Component, dp.Capability, dp.Key, tags, dp.Unit, dp.Value, dp.Heartbeat, polledAt, age}
+
+		key := readingKey(dp)
+		if i, ok := index[key]; ok {
+			rows[i] = row
+			continue
+		}
+		index[key] = len(rows)
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func readingKey(dp monitor.DeviceDataPoint) string {
+	tags := make([]string, 0, len(dp.Tags))
+	for k, v := range dp.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return strings.Join([]string{dp.DeviceId.String(), dp.Component, dp.Capability, dp.Key, strings.Join(tags, ","), dp.Timestamp.String()}, "/")
+}
+
+// readingsUpsert returns a multi row insert of the rows updating the
+// readings already recorded so replaying points is idempotent.
+func readingsUpsert(rows [][]any) (string, []any) {
+	values := make([]string, 0, len(rows))
+	args := make([]any, 0, len(rows)*len(readingsColumns))
+
+	for _, row := range rows {
+		placeholders := make([]string, len(row))
+		for i := range row {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args, row...)
+	}
+
+	return "INSERT INTO readings (" + strings.Join(readingsColumns, ", ") + ") VALUES " + strings.Join(values, ", ") +
+		" ON CONFLICT (device_id, component, capability, measurement, tags, time) DO UPDATE SET" +
+		" unit = EXCLUDED.unit, value = EXCLUDED.value, heartbeat = EXCLUDED.heartbeat," +
+		" polled_at = EXCLUDED.polled_at, age_seconds = EXCLUDED.age_seconds", args
+}
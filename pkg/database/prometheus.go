@@ -0,0 +1,197 @@
+package database
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const prometheusNamespace = "smartthings"
+
+var prometheusLabels = []string{"device", "device_id", "component", "capability", "attribute", "unit"}
+
+type prometheusSample struct {
+	name       string
+	deviceId   uuid.UUID
+	component  string
+	capability string
+	labels     []string
+	value      float64
+	// updated is the wall time the sample was last added
+	updated time.Time
+}
+
+// PrometheusExporter is a recorder that keeps the latest value of every
+// series in memory and exposes them as Prometheus gauges.
+type PrometheusExporter struct {
+	registerer prometheus.Registerer
+	staleness  time.Duration
+	now        func() time.Time
+	mu         sync.Mutex
+	samples    map[string]prometheusSample
+}
+
+// NewPrometheusExporter creates the exporter and registers it so its
+// gauges are served with the other registry metrics. Series not updated
+// for longer than staleness are no longer exposed, a zero staleness
+// keeps them until their device is removed.
+func NewPrometheusExporter(registerer prometheus.Registerer, staleness time.Duration) (*PrometheusExporter, error) {
+	exp := &PrometheusExporter{
+		registerer: registerer,
+		staleness:  staleness,
+		now:        time.Now,
+		samples:    make(map[string]prometheusSample),
+	}
+
+	err := registerer.Register(exp)
+	if err != nil {
+		return nil, err
+	}
+
+	return exp, nil
+}
+
+// Close unregisters the exporter.
+func (exp *PrometheusExporter) Close() error {
+	exp.registerer.Unregister(exp)
+
+	return nil
+}
+
+func (exp *PrometheusExporter) Add(datapoints []monitor.DeviceDataPoint) error {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	now := exp.now()
+	for _, dp := range datapoints {
+		if dp.Key == monitor.InventoryChangeMeasurement {
+			switch dp.Tags["event"] {
+			case monitor.DeviceRemoved:
+				exp.drop(dp.DeviceId, "", "")
+			case monitor.CapabilityRemoved:
+				exp.drop(dp.DeviceId, dp.Component, dp.Capability)
+			}
+
+			continue
+		}
+
+		sample := prometheusSample{
+			name:       PrometheusMetricName(dp.Key),
+			deviceId:   dp.DeviceId,
+			component:  dp.Component,
+			capability: dp.Capability,
+			labels:     []string{dp.Device, dp.DeviceId.String(), dp.Component, dp.Capability, pointAttribute(dp), dp.Unit},
+			value:      dp.Value,
+			updated:    now,
+		}
+		// Series are kept by what identifies them, so a relabeled device
+		// or a changed unit replaces the previous label set
+		key := strings.Join([]string{sample.name, dp.DeviceId.String(), dp.Component, dp.Capability, pointAttribute(dp)}, "/")
+		exp.samples[key] = sample
+	}
+
+	return nil
+}
+
+// drop removes the series of a device, only the ones of a component
+// capability when it is given.
+func (exp *PrometheusExporter) drop(deviceId uuid.UUID, component, capability string) {
+	for key, sample := range exp.samples {
+		if sample.deviceId != deviceId {
+			continue
+		}
+		if capability != "" && (sample.component != component || sample.capability != capability) {
+			continue
+		}
+		delete(exp.samples, key)
+	}
+}
+
+// Describe sends no descriptors making the exporter an unchecked
+// collector as its series are only known at collection.
+func (exp *PrometheusExporter) Describe(chan<- *prometheus.Desc) {}
+
+func (exp *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	now := exp.now()
+	descs := map[string]*prometheus.Desc{}
+	for key, sample := range exp.samples {
+		// Series of devices no longer reporting, or excluded since, expire
+		if exp.staleness > 0 && now.Sub(sample.updated) > exp.staleness {
+			delete(exp.samples, key)
+
+			continue
+		}
+
+		desc, ok := descs[sample.name]
+		if !ok {
+			desc = prometheus.NewDesc(sample.name, "SmartThings attribute "+sample.name, prometheusLabels, nil)
+			descs[sample.name] = desc
+		}
+
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, sample.value, sample.labels...)
+	}
+}
+
+// prometheusLabelSet returns the metric name and labels of a point,
+// including its tags, as pushed to remote storage.
+func prometheusLabelSet(dp monitor.DeviceDataPoint) map[string]string {
+	labels := map[string]string{}
+	for k, v := range dp.Tags {
+		labels[snakeCase(k)] = v
+	}
+
+	labels["__name__"] = PrometheusMetricName(dp.Key)
+	labels["device"] = dp.Device
+	labels["device_id"] = dp.DeviceId.String()
+	labels["component"] = dp.Component
+	labels["capability"] = dp.Capability
+	labels["attribute"] = pointAttribute(dp)
+	if dp.Unit != "" {
+		labels["unit"] = dp.Unit
+	}
+
+	return labels
+}
+
+// PrometheusMetricName returns the gauge name for an attribute turning
+// camel case into snake case and dropping invalid characters, for
+// instance relativeHumidity into smartthings_relative_humidity.
+func PrometheusMetricName(attribute string) string {
+	return prometheusNamespace + "_" + snakeCase(attribute)
+}
+
+// snakeCase turns a camel case name into snake case replacing characters
+// not allowed in Prometheus names by underscores.
+func snakeCase(name string) string {
+	var b strings.Builder
+
+	lastUnderscore, lastLower := true, false
+	for _, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if lastLower {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			lastUnderscore, lastLower = false, false
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			lastUnderscore, lastLower = false, true
+		default:
+			if !lastUnderscore {
+				b.WriteRune('_')
+			}
+			lastUnderscore, lastLower = true, false
+		}
+	}
+
+	return strings.Trim(b.String(), "_")
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetricName(t *testing.T) {
+	tests := []struct {
+		attribute string
+		want      string
+	}{
+		{attribute: "temperature", want: "smartthings_temperature"},
+		{attribute: "relativeHumidity", want: "smartthings_relative_humidity"},
+		{attribute: "sensorStale", want: "smartthings_sensor_stale"},
+		{attribute: "co2-level.", want: "smartthings_co2_level"},
+		{attribute: "fineDustPM25", want: "smartthings_fine_dust_pm25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attribute, func(t *testing.T) {
+			if got := PrometheusMetricName(tt.attribute); got != tt.want {
+				t.Errorf("PrometheusMetricName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusExporter_Add(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	exp, err := NewPrometheusExporter(reg, 0)
+	if err != nil {
+		t.Fatalf("NewPrometheusExporter() error = %v", err)
+	}
+
+	kitchen := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	garage := uuid.MustParse("0b7e9f2c-2f0e-4d3b-9d5a-3c1f0e3b9c1a")
+
+	err = exp.Add([]monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: kitchen, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 20},
+		{Key: "temperature", DeviceId: garage, Device: "Garage", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 12},
+		{Key: "temperature", DeviceId: kitchen, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5},
+		{Key: monitor.SensorStaleMeasurement, DeviceId: garage, Device: "Garage", Component: "main", Capability: "temperatureMeasurement", Value: 1, Tags: map[string]string{"attribute": "temperature"}},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	expected := `
+# HELP smartthings_sensor_stale SmartThings attribute smartthings_sensor_stale
+# TYPE smartthings_sensor_stale gauge
+smartthings_sensor_stale{attribute="temperature",capability="temperatureMeasurement",component="main",device="Garage",device_id="0b7e9f2c-2f0e-4d3b-9d5a-3c1f0e3b9c1a",unit=""} 1
+# HELP smartthings_temperature SmartThings attribute smartthings_temperature
+# TYPE smartthings_temperature gauge
+smartthings_temperature{attribute="temperature",capability="temperatureMeasurement",component="main",device="Garage",device_id="0b7e9f2c-2f0e-4d3b-9d5a-3c1f0e3b9c1a",unit="C"} 12
+smartthings_temperature{attribute="temperature",capability="temperatureMeasurement",component="main",device="Kitchen",device_id="9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5",unit="C"} 21.5
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+
+	// Removed devices drop their series
+	err = exp.Add([]monitor.DeviceDataPoint{
+		{Key: monitor.InventoryChangeMeasurement, DeviceId: garage, Device: "Garage", Value: 1, Tags: map[string]string{"event": monitor.DeviceRemoved}},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	expected = `
+# HELP smartthings_temperature SmartThings attribute smartthings_temperature
+# TYPE smartthings_temperature gauge
+smartthings_temperature{attribute="temperature",capability="temperatureMeasurement",component="main",device="Kitchen",device_id="9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5",unit="C"} 21.5
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics after device removal: %v", err)
+	}
+}
+
+func TestPrometheusExporter_Series(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	exp, err := NewPrometheusExporter(reg, time.Hour)
+	if err != nil {
+		t.Fatalf("NewPrometheusExporter() error = %v", err)
+	}
+	defer exp.Close()
+
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	exp.now = func() time.Time { return now }
+
+	kitchen := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	garage := uuid.MustParse("0b7e9f2c-2f0e-4d3b-9d5a-3c1f0e3b9c1a")
+
+	err = exp.Add([]monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: kitchen, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 20},
+		{Key: "humidity", DeviceId: kitchen, Device: "Kitchen", Component: "main", Capability: "relativeHumidityMeasurement", Unit: "%", Value: 40},
+		{Key: "temperature", DeviceId: garage, Device: "Garage", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 12},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// Relabeled device with a changed unit, humidity capability removed
+	now = now.Add(50 * time.Minute)
+	err = exp.Add([]monitor.DeviceDataPoint{
+		{Key: monitor.InventoryChangeMeasurement, DeviceId: kitchen, Device: "Kitchen Sensor", Value: 1, Tags: map[string]string{"event": monitor.DeviceRelabeled, "previous": "Kitchen"}},
+		{Key: monitor.InventoryChangeMeasurement, DeviceId: kitchen, Device: "Kitchen Sensor", Component: "main", Capability: "relativeHumidityMeasurement", Value: 1, Tags: map[string]string{"event": monitor.CapabilityRemoved}},
+		{Key: "temperature", DeviceId: kitchen, Device: "Kitchen Sensor", Component: "main", Capability: "temperatureMeasurement", Unit: "F", Value: 68},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// The garage series is not updated within the staleness window
+	now = now.Add(20 * time.Minute)
+
+	expected := `
+# HELP smartthings_temperature SmartThings attribute smartthings_temperature
+# TYPE smartthings_temperature gauge
+smartthings_temperature{attribute="temperature",capability="temperatureMeasurement",component="main",device="Kitchen Sensor",device_id="9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5",unit="F"} 68
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
+
+func TestPrometheusExporter_Conformance(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			exp, err := NewPrometheusExporter(registry, 0)
+			if err != nil {
+				t.Fatalf("NewPrometheusExporter() error = %v", err)
+			}
+			// Closing unregisters, unclosed exporters fail the next test
+			return exp
+		},
+	})
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+	"github.com/influxdata/influxdb/models"
+)
+
+// FormatLineProtocol is the InfluxDB line protocol format.
+const FormatLineProtocol = "lineprotocol"
+
+// PointReader reads archived data points one at a time.
+type PointReader interface {
+	// Next returns the next data point or io.EOF when there are no more.
+	Next() (monitor.DeviceDataPoint, error)
+}
+
+// NewPointReader reads data points in format: csv and jsonl as written by
+// the file recorder, or line protocol as written to InfluxDB with
+// timestamps in precision.
+func NewPointReader(r io.Reader, format string, precision string) (PointReader, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		return &jsonlReader{lines: newLineReader(r)}, nil
+	case FormatLineProtocol:
+		if precision == "" {
+			precision = "ns"
+		}
+		return &lineProtocolReader{lines: newLineReader(r), precision: precision}, nil
+	}
+
+	return nil, fmt.Errorf("invalid format %q, must be %s, %s or %s", format, FormatCSV, FormatJSONL, FormatLineProtocol)
+}
+
+type lineReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReader(r)}
+}
+
+// next returns the next line that is not blank.
+func (l *lineReader) next() ([]byte, error) {
+	for {
+		line, err := l.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		l.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+type csvReader struct {
+	reader *csv.Reader
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(FileColumns)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read csv header: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(FileColumns, ",") {
+		return nil, fmt.Errorf("unexpected csv header %q, expected %q", strings.Join(header, ","), strings.Join(FileColumns, ","))
+	}
+
+	return &csvReader{reader: reader}, nil
+}
+
+func (r *csvReader) Next() (monitor.DeviceDataPoint, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return monitor.DeviceDataPoint{}, err
+	}
+
+	record, err := ParseFileRecordCSV(row)
+	if err != nil {
+		line, _ := r.reader.FieldPos(0)
+		return monitor.DeviceDataPoint{}, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	return record.Point(), nil
+}
+
+type jsonlReader struct {
+	lines *lineReader
+}
+
+func (r *jsonlReader) Next() (monitor.DeviceDataPoint, error) {
+	line, err := r.lines.next()
+	if err != nil {
+		return monitor.DeviceDataPoint{}, err
+	}
+
+	var record FileRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return monitor.DeviceDataPoint{}, fmt.Errorf("line %d: %w", r.lines.line, err)
+	}
+
+	return record.Point(), nil
+}
+
+type lineProtocolReader struct {
+	lines     *lineReader
+	precision string
+}
+
+func (r *lineProtocolReader) Next() (monitor.DeviceDataPoint, error) {
+	for {
+		line, err := r.lines.next()
+		if err != nil {
+			return monitor.DeviceDataPoint{}, err
+		}
+
+		// Skip comments and statements of influx_inspect exports
+		if line[0] == '#' || bytes.HasPrefix(line, []byte("CREATE ")) {
+			continue
+		}
+
+		points, err := models.ParsePointsWithPrecision(line, time.Now(), r.precision)
+		if err != nil {
+			return monitor.DeviceDataPoint{}, fmt.Errorf("line %d: %w", r.lines.line, err)
+		}
+		if len(points) != 1 {
+			return monitor.DeviceDataPoint{}, fmt.Errorf("line %d: expected one point, got %d", r.lines.line, len(points))
+		}
+
+		dp, err := lineProtocolPoint(points[0])
+		if err != nil {
+			return monitor.DeviceDataPoint{}, fmt.Errorf("line %d: %w", r.lines.line, err)
+		}
+
+		return dp, nil
+	}
+}
+
+// LineProtocolDeviceId is the device ID given to points read from line
+// protocol, which does not keep it. It is derived from the device label
+// so points of a device keep being grouped.
+func LineProtocolDeviceId(device string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("smartthings-influx:device:"+device))
+}
+
+// lineProtocolPoint converts a point with the schema of pointTags and
+// pointFields back to a data point.
+func lineProtocolPoint(p models.Point) (monitor.DeviceDataPoint, error) {
+	dp := monitor.DeviceDataPoint{
+		Key:       string(p.Name()),
+		Timestamp: p.Time().UTC(),
+	}
+	dp.SensorTime = dp.Timestamp
+
+	for _, tag := range p.Tags() {
+		value := string(tag.Value)
+		switch string(tag.Key) {
+		case "device":
+			dp.Device = value
+		case "component":
+			dp.Component = value
+		case "capability":
+			dp.Capability = value
+		case "unit":
+			dp.Unit = value
+		default:
+			if dp.Tags == nil {
+				dp.Tags = map[string]string{}
+			}
+			dp.Tags[string(tag.Key)] = value
+		}
+	}
+	dp.DeviceId = LineProtocolDeviceId(dp.Device)
+
+	fields, err := p.Fields()
+	if err != nil {
+		return dp, err
+	}
+
+	value, ok := number(fields["value"])
+	if !ok {
+		return dp, fmt.Errorf("point has no numeric value field")
+	}
+	dp.Value = value
+
+	if heartbeat, ok := fields["heartbeat"].(bool); ok {
+		dp.Heartbeat = heartbeat
+	}
+
+	if polledAt, ok := number(fields["polled_at"]); ok {
+		dp.PolledAt = time.Unix(int64(polledAt), 0).UTC()
+		age, _ := number(fields["age"])
+		dp.Age = time.Duration(age * float64(time.Second))
+		dp.SensorTime = dp.PolledAt.Add(-dp.Age)
+	}
+
+	return dp, nil
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r PointReader) []monitor.DeviceDataPoint {
+	points := []monitor.DeviceDataPoint{}
+	for {
+		dp, err := r.Next()
+		if err == io.EOF {
+			return points
+		}
+		require.NoError(t, err)
+		points = append(points, dp)
+	}
+}
+
+func TestPointReader_FileFormats(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "readings."+format)
+			f, err := NewFileRecorder(path, format, 0, 0, false)
+			require.NoError(t, err)
+			require.NoError(t, f.Add(filePoints()))
+
+			in, err := os.Open(path)
+			require.NoError(t, err)
+			defer in.Close()
+
+			r, err := NewPointReader(in, format, "")
+			require.NoError(t, err)
+			assert.Equal(t, filePoints(), readAll(t, r))
+		})
+	}
+}
+
+func TestPointReader_LineProtocol(t *testing.T) {
+	export := `# DDL
+CREATE DATABASE SmartThings WITH NAME autogen
+# DML
+# CONTEXT-DATABASE:SmartThings
+
+temperature,capability=temperatureMeasurement,component=main,device=Kitchen,unit=C value=21.5 1709287200000000000
+temperature,capability=temperatureMeasurement,component=main,device=Kitchen,unit=C age=3600,heartbeat=true,polled_at=1709290800i,value=21 1709290800000000000
+sensorStale,attribute=temperature,capability=temperatureMeasurement,component=main,device=Kitchen value=1i 1709287200000000000
+`
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := LineProtocolDeviceId("Kitchen")
+
+	r, err := NewPointReader(strings.NewReader(export), FormatLineProtocol, "ns")
+	require.NoError(t, err)
+
+	assert.Equal(t, []monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts, SensorTime: ts},
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21, Timestamp: ts.Add(time.Hour), SensorTime: ts, Heartbeat: true, PolledAt: ts.Add(time.Hour), Age: time.Hour},
+		{Key: "sensorStale", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts, SensorTime: ts, Tags: map[string]string{"attribute": "temperature"}},
+	}, readAll(t, r))
+}
+
+func TestPointReader_Errors(t *testing.T) {
+	_, err := NewPointReader(strings.NewReader(""), "xml", "")
+	assert.Error(t, err)
+
+	_, err = NewPointReader(strings.NewReader("a,b\n"), FormatCSV, "")
+	assert.ErrorContains(t, err, "csv header")
+
+	r, err := NewPointReader(strings.NewReader("{}\nnot json\n"), FormatJSONL, "")
+	require.NoError(t, err)
+	_, err = r.Next()
+	require.NoError(t, err)
+	_, err = r.Next()
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWrite is a recorder that pushes points to a Prometheus
+// remote_write endpoint such as Mimir, VictoriaMetrics or Thanos.
+type RemoteWrite struct {
+	poster
+	url    string
+	header http.Header
+}
+
+// NewRemoteWriteClient creates a remote_write recorder. A token enables
+// bearer authentication, otherwise a user enables basic authentication.
+func NewRemoteWriteClient(url, user, password, token string) (*RemoteWrite, error) {
+	if url == "" {
+		return nil, fmt.Errorf("remote write url is not set")
+	}
+
+	header := http.Header{}
+	header.Set("Content-Encoding", "snappy")
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	} else if user != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+	}
+
+	return &RemoteWrite{
+		poster: newPoster(30 * time.Second),
+		url:    url,
+		header: header,
+	}, nil
+}
+
+func (db RemoteWrite) Add(datapoints []monitor.DeviceDataPoint) error {
+	if len(datapoints) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, remoteWriteRequest(datapoints))
+
+	_, err := db.post("remote write", db.url, body, db.header)
+	if err != nil {
+		return fmt.Errorf("could not write set of points to remote write: %w", err)
+	}
+
+	return nil
+}
+
+// remoteWriteRequest encodes the points as a remote_write WriteRequest
+// protobuf message, one time series per point:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func remoteWriteRequest(datapoints []monitor.DeviceDataPoint) []byte {
+	var req []byte
+
+	for _, dp := range datapoints {
+		labels := prometheusLabelSet(dp)
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		// Labels must be sorted by name
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, labels[name])
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(dp.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(dp.Timestamp.UnixMilli()))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+
+	return req
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type remoteSample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a remote_write WriteRequest into samples.
+func decodeWriteRequest(t *testing.T, b []byte) []remoteSample {
+	samples := []remoteSample{}
+
+	fields(t, b, func(num protowire.Number, series []byte) {
+		s := remoteSample{labels: map[string]string{}}
+		fields(t, series, func(num protowire.Number, v []byte) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				s.labels[name] = value
+			case 2:
+				fields(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(ts)
+					}
+				})
+			}
+		})
+		samples = append(samples, s)
+	})
+
+	return samples
+}
+
+// fields walks the fields of a message calling f with the raw value.
+func fields(t *testing.T, b []byte, f func(protowire.Number, []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0, "invalid tag")
+		b = b[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			v, n = b[:8], 8
+		case protowire.VarintType:
+			_, n = protowire.ConsumeVarint(b)
+			v = b[:n]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		require.GreaterOrEqual(t, n, 0, "invalid value")
+		b = b[n:]
+
+		f(num, v)
+	}
+}
+
+func TestRemoteWrite_Add(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	var received []remoteSample
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		// Fail the first request to exercise retries
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		received = decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	db, err := NewRemoteWriteClient(srv.URL, "", "", "secret")
+	require.NoError(t, err)
+	db.delay = time.Millisecond
+
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	err = db.Add([]monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts},
+		{Key: monitor.SensorStaleMeasurement, DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts.Add(time.Hour), Tags: map[string]string{"attribute": "temperature"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, []remoteSample{
+		{
+			labels: map[string]string{
+				"__name__":   "smartthings_temperature",
+				"attribute":  "temperature",
+				"capability": "temperatureMeasurement",
+				"component":  "main",
+				"device":     "Kitchen",
+				"device_id":  id.String(),
+				"unit":       "C",
+			},
+			value:     21.5,
+			timestamp: ts.UnixMilli(),
+		},
+		{
+			labels: map[string]string{
+				"__name__":   "smartthings_sensor_stale",
+				"attribute":  "temperature",
+				"capability": "temperatureMeasurement",
+				"component":  "main",
+				"device":     "Kitchen",
+				"device_id":  id.String(),
+			},
+			value:     1,
+			timestamp: ts.Add(time.Hour).UnixMilli(),
+		},
+	}, received)
+}
+
+func TestRemoteWrite_Auth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	point := []monitor.DeviceDataPoint{{Key: "temperature", Value: 20, Timestamp: time.Now()}}
+
+	db, err := NewRemoteWriteClient(srv.URL, "user", "pass", "")
+	require.NoError(t, err)
+	assert.NoError(t, db.Add(point))
+
+	// Client errors are not retried
+	db, err = NewRemoteWriteClient(srv.URL, "user", "wrong", "")
+	require.NoError(t, err)
+	db.delay = time.Hour
+	assert.ErrorContains(t, db.Add(point), "401")
+}
+
+func TestRemoteWrite_Conformance(t *testing.T) {
+	var mu sync.Mutex
+	var samples int
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			mu.Lock()
+			samples = 0
+			mu.Unlock()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				compressed, _ := io.ReadAll(r.Body)
+				body, err := snappy.Decode(nil, compressed)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				mu.Lock()
+				samples += len(decodeWriteRequest(t, body))
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			t.Cleanup(srv.Close)
+
+			db, err := NewRemoteWriteClient(srv.URL, "", "", "")
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int {
+			mu.Lock()
+			defer mu.Unlock()
+			return samples
+		},
+	})
+}
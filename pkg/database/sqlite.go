@@ -0,0 +1,219 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+	// Pure Go driver, builds with CGO_ENABLED=0
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePruneInterval is how often readings older than the retention are
+// deleted.
+const sqlitePruneInterval = time.Hour
+
+// sqliteSchema creates the schema. Times are Unix milliseconds.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS readings (
+	time        INTEGER NOT NULL,
+	device_id   TEXT NOT NULL,
+	device      TEXT NOT NULL,
+	room        TEXT NOT NULL DEFAULT '',
+	component   TEXT NOT NULL,
+	capability  TEXT NOT NULL,
+	measurement TEXT NOT NULL,
+	tags        TEXT NOT NULL DEFAULT '{}',
+	unit        TEXT NOT NULL DEFAULT '',
+	value       REAL NOT NULL,
+	heartbeat   INTEGER NOT NULL DEFAULT 0,
+	polled_at   INTEGER,
+	age_seconds REAL,
+	PRIMARY KEY (device_id, component, capability, measurement, tags, time)
+);
+CREATE INDEX IF NOT EXISTS readings_device_idx ON readings (device, measurement, time);
+CREATE INDEX IF NOT EXISTS readings_time_idx ON readings (time);
+`
+
+// SQLite is a recorder that keeps readings in an embedded SQLite
+// database file.
+type SQLite struct {
+	db        *sql.DB
+	retention time.Duration
+	mu        sync.Mutex
+	created   bool
+	lastPrune time.Time
+}
+
+// NewSQLiteClient creates a SQLite recorder on the database file at path.
+// Readings older than retention are deleted, a zero retention keeps them
+// forever.
+func NewSQLiteClient(path string, retention time.Duration) (*SQLite, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite database path is not set")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite database: %w", err)
+	}
+
+	return &SQLite{db: db, retention: retention}, nil
+}
+
+// init creates the schema once per process.
+func (db *SQLite) init() error {
+	if db.created {
+		return nil
+	}
+
+	_, err := db.db.Exec(sqliteSchema)
+	if err != nil {
+		return fmt.Errorf("could not create sqlite schema: %w", err)
+	}
+	db.created = true
+
+	return nil
+}
+
+// Open creates the schema.
+func (db *SQLite) Open() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.init()
+}
+
+func (db *SQLite) Close() error {
+	return db.db.Close()
+}
+
+func (db *SQLite) Add(datapoints []monitor.DeviceDataPoint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.init()
+	if err == nil {
+		err = db.insert(datapoints)
+	}
+	if err != nil {
+		return err
+	}
+
+	if db.retention > 0 && time.Since(db.lastPrune) > sqlitePruneInterval {
+		err := db.prune(time.Now().Add(-db.retention))
+		if err != nil {
+			log.Printf("ERROR: could not prune sqlite readings: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *SQLite) insert(datapoints []monitor.DeviceDataPoint) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start sqlite transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO readings
+		(time, device_id, device, room, component, capability, measurement, tags, unit, value, heartbeat, polled_at, age_seconds)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (device_id, component, capability, measurement, tags, time) DO UPDATE SET
+		device = excluded.device, room = excluded.room, unit = excluded.unit, value = excluded.value,
+		heartbeat = excluded.heartbeat, polled_at = excluded.polled_at, age_seconds = excluded.age_seconds`)
+	if err != nil {
+		return fmt.Errorf("could not prepare sqlite insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, dp := range datapoints {
+		// Map keys are sorted when encoded so equal tags have equal text
+		tags, err := json.Marshal(dp.Tags)
+		if err != nil || dp.Tags == nil {
+			tags = []byte("{}")
+		}
+
+		var polledAt, age any
+		if !dp.PolledAt.IsZero() {
+			polledAt = dp.PolledAt.UnixMilli()
+			age = dp.Age.Seconds()
+		}
+
+		_, err = stmt.Exec(dp.Timestamp.UnixMilli(), dp.DeviceId.String(), dp.Device, dp.Room, dp.Component, dp.Capability,
+			dp.Key, string(tags), dp.Unit, dp.Value, dp.Heartbeat, polledAt, age)
+		if err != nil {
+			return fmt.Errorf("could not insert sqlite reading: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// prune deletes the readings older than before.
+func (db *SQLite) prune(before time.Time) error {
+	res, err := db.db.Exec("DELETE FROM readings WHERE time < ?", before.UnixMilli())
+	if err != nil {
+		return err
+	}
+	db.lastPrune = time.Now()
+
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		log.Printf("Pruned %d sqlite readings older than %s", n, before.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Query returns the readings of an attribute of a device, by label or ID,
+// recorded from from (inclusive) to to (exclusive) in time order.
+func (db *SQLite) Query(device string, attribute string, from time.Time, to time.Time) ([]monitor.DeviceDataPoint, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.Query(`SELECT time, device_id, device, room, component, capability, measurement, tags, unit, value, heartbeat
+		FROM readings
+		WHERE (device = ? OR device_id = ?) AND measurement = ? AND time >= ? AND time < ?
+		ORDER BY time`, device, device, attribute, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("could not query sqlite readings: %w", err)
+	}
+	defer rows.Close()
+
+	result := []monitor.DeviceDataPoint{}
+	for rows.Next() {
+		var ts int64
+		var id, tags string
+		dp := monitor.DeviceDataPoint{}
+
+		err := rows.Scan(&ts, &id, &dp.Device, &dp.Room, &dp.Component, &dp.Capability, &dp.Key, &tags, &dp.Unit, &dp.Value, &dp.Heartbeat)
+		if err != nil {
+			return nil, fmt.Errorf("could not read sqlite reading: %w", err)
+		}
+
+		dp.Timestamp = time.UnixMilli(ts).UTC()
+		dp.DeviceId, err = uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device id %q: %w", id, err)
+		}
+		if tags != "{}" {
+			if err := json.Unmarshal([]byte(tags), &dp.Tags); err != nil {
+				return nil, fmt.Errorf("invalid tags %q: %w", tags, err)
+			}
+		}
+
+		result = append(result, dp)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLite(t *testing.T) {
+	db, err := NewSQLiteClient(filepath.Join(t.TempDir(), "readings.db"), 0)
+	require.NoError(t, err)
+
+	id := uuid.MustParse("9a8d7e5a-9a4b-4bd4-b8a2-64ab3bcbd8b5")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	point := func(value float64, at time.Time) monitor.DeviceDataPoint {
+		return monitor.DeviceDataPoint{Key: "temperature", DeviceId: id, Device: "Kitchen", Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: value, Timestamp: at}
+	}
+
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{
+		point(20, ts),
+		point(21, ts.Add(time.Hour)),
+		point(22, ts.Add(2*time.Hour)),
+		{Key: monitor.SensorStaleMeasurement, DeviceId: id, Device: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: ts, Tags: map[string]string{"attribute": "temperature"}},
+	}))
+	// Replays update instead of duplicating
+	require.NoError(t, db.Add([]monitor.DeviceDataPoint{point(20.5, ts)}))
+
+	var mode string
+	require.NoError(t, db.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	got, err := db.Query("Kitchen", "temperature", ts, ts.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []monitor.DeviceDataPoint{point(20.5, ts), point(21, ts.Add(time.Hour))}, got)
+
+	got, err = db.Query(id.String(), monitor.SensorStaleMeasurement, ts, ts.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, map[string]string{"attribute": "temperature"}, got[0].Tags)
+
+	require.NoError(t, db.prune(ts.Add(90*time.Minute)))
+	got, err = db.Query("Kitchen", "temperature", ts, ts.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []monitor.DeviceDataPoint{point(22, ts.Add(2*time.Hour))}, got)
+}
+
+func TestSQLite_Conformance(t *testing.T) {
+	var db *SQLite
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			var err error
+			db, err = NewSQLiteClient(filepath.Join(t.TempDir(), "readings.db"), 0)
+			require.NoError(t, err)
+			return db
+		},
+		Written: func(t *testing.T) int {
+			var count int
+			db.db.QueryRow("SELECT COUNT(*) FROM readings").Scan(&count)
+			return count
+		},
+	})
+}
@@ -0,0 +1,138 @@
+// Package metrics holds the Prometheus metrics smartthings-influx
+// exposes about itself.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "smartthings_influx"
+
+// inventoryFetched is the Unix time in nanoseconds the device inventory
+// was last fetched, zero until it is.
+var inventoryFetched atomic.Int64
+
+var (
+	// InventoryCacheAge is the age of the cached SmartThings device list.
+	// It is computed when scraped so it keeps growing between cycles.
+	InventoryCacheAge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inventory_cache_age_seconds",
+		Help:      "Age of the cached SmartThings device inventory.",
+	}, func() float64 {
+		fetched := inventoryFetched.Load()
+		if fetched == 0 {
+			return 0
+		}
+
+		return time.Since(time.Unix(0, fetched)).Seconds()
+	})
+
+	// CycleDuration is the duration of monitor cycles.
+	CycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cycle_duration_seconds",
+		Help:      "Duration of monitor poll cycles.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+
+	// SmartThingsRequests counts SmartThings API requests by status code.
+	SmartThingsRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "smartthings_requests_total",
+		Help:      "SmartThings API requests by status code.",
+	}, []string{"code"})
+
+	// SmartThingsRequestDuration is the latency of SmartThings API
+	// requests by status code.
+	SmartThingsRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "smartthings_request_duration_seconds",
+		Help:      "Latency of SmartThings API requests by status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"code"})
+
+	// ConversionErrors counts values that could not be converted to numbers.
+	ConversionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversion_errors_total",
+		Help:      "Attribute values that could not be converted to numbers.",
+	}, []string{"capability", "attribute"})
+
+	// PointsWritten counts points written by recorder.
+	PointsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_written_total",
+		Help:      "Points written by recorder.",
+	}, []string{"recorder"})
+
+	// PointsFailed counts points that failed to be written by recorder.
+	PointsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_failed_total",
+		Help:      "Points that failed to be written by recorder.",
+	}, []string{"recorder"})
+
+	// LastWrite is the time of the last successful write by recorder.
+	LastWrite = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_write_timestamp_seconds",
+		Help:      "Unix time of the last successful write by recorder.",
+	}, []string{"recorder"})
+
+	// DedupSkips counts readings skipped by sink because they did not change.
+	DedupSkips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dedup_skips_total",
+		Help:      "Readings skipped by sink because their timestamp did not change.",
+	}, []string{"sink"})
+
+	// DeadbandSkips counts readings skipped by sink because they were within
+	// the capability deadband.
+	DeadbandSkips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deadband_skips_total",
+		Help:      "Readings skipped by sink because their change was within the deadband.",
+	}, []string{"sink"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a SmartThings API request. Requests that got no
+// answer have code zero.
+func ObserveRequest(code int, duration time.Duration) {
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+
+	SmartThingsRequests.WithLabelValues(label).Inc()
+	SmartThingsRequestDuration.WithLabelValues(label).Observe(duration.Seconds())
+}
+
+// ObserveInventory records the time the device inventory was fetched.
+func ObserveInventory(fetched time.Time) {
+	inventoryFetched.Store(fetched.UnixNano())
+}
+
+// ObserveWrite records the outcome of a recorder writing points.
+func ObserveWrite(recorder string, written int, failed int) {
+	if written > 0 {
+		PointsWritten.WithLabelValues(recorder).Add(float64(written))
+		LastWrite.WithLabelValues(recorder).SetToCurrentTime()
+	}
+
+	if failed > 0 {
+		PointsFailed.WithLabelValues(recorder).Add(float64(failed))
+	}
+}
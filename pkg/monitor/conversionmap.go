@@ -38,3 +38,24 @@ func (c ConversionMap) Convert(metric string, value any) (float64, error) {
 	}
 	return 0, fmt.Errorf("there is no value map for metric '%s' and value '%v', can't convert", metric, value)
 }
+
+// Merge returns a new map with the values of other added to the values
+// of c, replacing the ones already there. Metric names are lowercased
+// so both maps meet on the same keys.
+func (c ConversionMap) Merge(other ConversionMap) ConversionMap {
+	merged := ConversionMap{}
+
+	for _, m := range []ConversionMap{c, other} {
+		for metric, values := range m {
+			metric = strings.ToLower(metric)
+			if merged[metric] == nil {
+				merged[metric] = map[string]float64{}
+			}
+			for value, number := range values {
+				merged[metric][value] = number
+			}
+		}
+	}
+
+	return merged
+}
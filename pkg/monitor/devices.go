@@ -1,15 +1,106 @@
 package monitor
 
+import (
+	"math"
+	"strings"
+	"time"
+)
+
 type ReadTime string
 
 const (
 	SensorTime ReadTime = "sensor"
 	WallTime   ReadTime = "wall"
+	// BothTimes records at sensor time adding the poll time and the age
+	// of the reading
+	BothTimes ReadTime = "both"
 )
 
 type MonitorCapability struct {
 	Name string
 	Time ReadTime
+	// Dedup skips readings whose timestamp did not change since the last
+	// record. Defaults to true.
+	Dedup *bool
+	// Interval is how often the capability is polled. Defaults to the
+	// monitor period.
+	Interval time.Duration
+	// Heartbeat records unchanged readings again at wall time when the
+	// series was not recorded for this long. Disabled when zero.
+	Heartbeat time.Duration
+	// Deadband skips readings that changed too little since last record
+	Deadband Deadband
+	// Stale is the reading age after which the sensor is considered
+	// stale. Disabled when zero.
+	Stale time.Duration
+	// Attributes, when set, restricts recording to the listed attributes
+	Attributes []string
+	// ExcludeAttributes lists attributes that are never recorded
+	ExcludeAttributes []string `mapstructure:"exclude_attributes"`
 }
 
 type MonitorCapabilities []MonitorCapability
+
+// Deadband sets thresholds below which a value change is not recorded.
+// A change is insignificant when it is within the absolute threshold
+// or within the percentage of the last recorded value.
+type Deadband struct {
+	Absolute float64
+	Percent  float64
+	// MaxSilence records a reading regardless of the thresholds when the
+	// series was not recorded for this long. Disabled when zero.
+	MaxSilence time.Duration `mapstructure:"max_silence"`
+}
+
+// IsEmpty tells if the deadband has no thresholds set.
+func (d Deadband) IsEmpty() bool {
+	return d.Absolute <= 0 && d.Percent <= 0
+}
+
+// Suppresses tells if the change from last to value is insignificant.
+func (d Deadband) Suppresses(last float64, value float64) bool {
+	change := math.Abs(value - last)
+
+	if d.Absolute > 0 && change < d.Absolute {
+		return true
+	}
+
+	return d.Percent > 0 && change < math.Abs(last)*d.Percent/100
+}
+
+// Records tells if the attribute should be recorded according to the
+// capability allow and deny lists. Names are compared ignoring case
+// as configuration files may not keep it.
+func (mc MonitorCapability) Records(attribute string) bool {
+	if len(mc.Attributes) > 0 && !containsFold(mc.Attributes, attribute) {
+		return false
+	}
+
+	return !containsFold(mc.ExcludeAttributes, attribute)
+}
+
+// UnknownAttributes returns the configured attribute names that are not
+// part of the attributes reported by the device for the capability.
+func (mc MonitorCapability) UnknownAttributes(reported []string) []string {
+	unknown := []string{}
+
+	for _, list := range [][]string{mc.Attributes, mc.ExcludeAttributes} {
+		for _, name := range list {
+			if !containsFold(reported, name) {
+				unknown = append(unknown, name)
+			}
+		}
+	}
+
+	return unknown
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
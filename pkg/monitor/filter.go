@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+)
+
+// DeviceFilter selects devices by any of its criteria. A device matches
+// the filter if it matches at least one of the listed values.
+type DeviceFilter struct {
+	// IDs are device UUIDs
+	IDs []string
+	// Labels are glob patterns matched against the device label
+	Labels []string
+	// LabelRegex are regular expressions matched against the device label
+	LabelRegex []string `mapstructure:"label_regex"`
+	// Rooms are room names or room UUIDs
+	Rooms []string
+	// Names are glob patterns matched against the device name or device type name
+	Names []string
+	// Profiles are device profile UUIDs
+	Profiles []string
+}
+
+// DeviceFilters include and exclude devices from monitoring. When Include
+// is empty all devices are included. Exclude has precedence over Include.
+type DeviceFilters struct {
+	Include DeviceFilter
+	Exclude DeviceFilter
+}
+
+func (f DeviceFilter) IsEmpty() bool {
+	return len(f.IDs)+len(f.Labels)+len(f.LabelRegex)+len(f.Rooms)+len(f.Names)+len(f.Profiles) == 0
+}
+
+// Validate checks that patterns and expressions on the filter are valid.
+func (f DeviceFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Labels...), f.Names...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+		}
+	}
+
+	for _, expr := range f.LabelRegex {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid label regular expression '%s': %w", expr, err)
+		}
+	}
+
+	return nil
+}
+
+// Matches tells if the device, located at the given room name, matches
+// any of the filter criteria.
+func (f DeviceFilter) Matches(d smartthings.Device, room string) bool {
+	for _, id := range f.IDs {
+		if strings.EqualFold(id, d.DeviceId.String()) {
+			return true
+		}
+	}
+
+	for _, pattern := range f.Labels {
+		if ok, _ := path.Match(pattern, d.Label); ok {
+			return true
+		}
+	}
+
+	for _, expr := range f.LabelRegex {
+		if ok, _ := regexp.MatchString(expr, d.Label); ok {
+			return true
+		}
+	}
+
+	for _, r := range f.Rooms {
+		if (room != "" && strings.EqualFold(r, room)) || strings.EqualFold(r, d.RoomId.String()) {
+			return true
+		}
+	}
+
+	for _, pattern := range f.Names {
+		if ok, _ := path.Match(pattern, d.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, d.DeviceTypeName); ok && d.DeviceTypeName != "" {
+			return true
+		}
+	}
+
+	for _, profile := range f.Profiles {
+		if strings.EqualFold(profile, d.Profile.Id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f DeviceFilters) Validate() error {
+	if err := f.Include.Validate(); err != nil {
+		return fmt.Errorf("include filter: %w", err)
+	}
+
+	if err := f.Exclude.Validate(); err != nil {
+		return fmt.Errorf("exclude filter: %w", err)
+	}
+
+	return nil
+}
+
+// Includes tells if the device at the given room passes the filters.
+func (f DeviceFilters) Includes(d smartthings.Device, room string) bool {
+	if !f.Include.IsEmpty() && !f.Include.Matches(d, room) {
+		return false
+	}
+
+	return !f.Exclude.Matches(d, room)
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+	"github.com/google/uuid"
+)
+
+func TestDeviceFilters_Includes(t *testing.T) {
+	bulb := smartthings.Device{
+		DeviceId: uuid.MustParse("f33840a1-f835-41ff-b8f8-b8c95d768363"),
+		Name:     "c2c-rgbw-color-bulb",
+		Label:    "Living Room Floor Lamp",
+		RoomId:   uuid.MustParse("6a3d5bb4-4dc4-4a2f-9d0e-30a2e3f1b0a1"),
+		Profile:  smartthings.Profile{Id: "0b1c2d3e-aaaa-bbbb-cccc-1234567890ab"},
+	}
+
+	tests := []struct {
+		name    string
+		filters DeviceFilters
+		room    string
+		want    bool
+	}{
+		{name: "no filters", filters: DeviceFilters{}, want: true},
+		{name: "include by id", filters: DeviceFilters{Include: DeviceFilter{IDs: []string{"F33840A1-F835-41FF-B8F8-B8C95D768363"}}}, want: true},
+		{name: "include other id", filters: DeviceFilters{Include: DeviceFilter{IDs: []string{uuid.NewString()}}}, want: false},
+		{name: "include by label glob", filters: DeviceFilters{Include: DeviceFilter{Labels: []string{"Living Room*"}}}, want: true},
+		{name: "include by label regex", filters: DeviceFilters{Include: DeviceFilter{LabelRegex: []string{"(?i)floor lamp$"}}}, want: true},
+		{name: "include by room name", filters: DeviceFilters{Include: DeviceFilter{Rooms: []string{"living room"}}}, room: "Living Room", want: true},
+		{name: "include by room id", filters: DeviceFilters{Include: DeviceFilter{Rooms: []string{"6a3d5bb4-4dc4-4a2f-9d0e-30a2e3f1b0a1"}}}, want: true},
+		{name: "include other room", filters: DeviceFilters{Include: DeviceFilter{Rooms: []string{"Kitchen"}}}, room: "Living Room", want: false},
+		{name: "exclude by name glob", filters: DeviceFilters{Exclude: DeviceFilter{Names: []string{"c2c-*-bulb"}}}, want: false},
+		{name: "exclude by profile", filters: DeviceFilters{Exclude: DeviceFilter{Profiles: []string{"0b1c2d3e-aaaa-bbbb-cccc-1234567890ab"}}}, want: false},
+		{name: "exclude wins over include", filters: DeviceFilters{
+			Include: DeviceFilter{Labels: []string{"*Lamp"}},
+			Exclude: DeviceFilter{Labels: []string{"Living*"}},
+		}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filters.Includes(bulb, tt.room); got != tt.want {
+				t.Errorf("DeviceFilters.Includes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceFilters_Validate(t *testing.T) {
+	if err := (DeviceFilters{Include: DeviceFilter{Labels: []string{"[a-"}}}).Validate(); err == nil {
+		t.Errorf("DeviceFilters.Validate() expected error on invalid glob")
+	}
+
+	if err := (DeviceFilters{Exclude: DeviceFilter{LabelRegex: []string{"(unclosed"}}}).Validate(); err == nil {
+		t.Errorf("DeviceFilters.Validate() expected error on invalid regex")
+	}
+
+	if err := (DeviceFilters{Include: DeviceFilter{Labels: []string{"*Lamp"}, LabelRegex: []string{"^Living"}}}).Validate(); err != nil {
+		t.Errorf("DeviceFilters.Validate() unexpected error %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// health keeps what the monitor knows about its dependencies so it can
+// be checked from other goroutines.
+type health struct {
+	mu sync.Mutex
+	// started is when the monitor started running
+	started time.Time
+	// lastCycle is when the last successful cycle completed
+	lastCycle time.Time
+	// smartThingsChecked tells if SmartThings was called at least once
+	smartThingsChecked bool
+	smartThingsErr     error
+	recorderErr        error
+}
+
+func (h *health) start(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.started = now
+}
+
+func (h *health) cycleCompleted(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastCycle = now
+}
+
+func (h *health) smartThings(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.smartThingsChecked = true
+	h.smartThingsErr = err
+}
+
+func (h *health) recorder(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.recorderErr = err
+}
+
+// Liveness returns an error when no cycle completed successfully within
+// the given number of monitor periods. Cycles run at least once a period.
+func (mon Monitor) Liveness(periods int) error {
+	mon.health.mu.Lock()
+	defer mon.health.mu.Unlock()
+
+	last := mon.health.lastCycle
+	if last.IsZero() {
+		// Give the first cycle time to complete
+		last = mon.health.started
+	}
+
+	if last.IsZero() {
+		return fmt.Errorf("monitor is not running")
+	}
+
+	window := time.Duration(periods) * mon.period
+	if age := mon.clock.Now().Sub(last); age > window {
+		return fmt.Errorf("no cycle completed in the last %s, last one at %s", window, mon.health.lastCycle)
+	}
+
+	return nil
+}
+
+// Readiness returns an error when the monitor is not configured, or when
+// SmartThings or the recorder failed on their last use.
+func (mon Monitor) Readiness() error {
+	if mon.client == nil {
+		return fmt.Errorf("SmartThings client not configured")
+	}
+
+	mon.health.mu.Lock()
+	defer mon.health.mu.Unlock()
+
+	if !mon.health.smartThingsChecked {
+		return fmt.Errorf("SmartThings not reached yet")
+	}
+
+	if mon.health.smartThingsErr != nil {
+		return fmt.Errorf("SmartThings unreachable: %w", mon.health.smartThingsErr)
+	}
+
+	if mon.health.recorderErr != nil {
+		return fmt.Errorf("recorder unreachable: %w", mon.health.recorderErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+	"github.com/google/uuid"
+)
+
+// importState is what the monitor keeps between imported batches.
+type importState struct {
+	// devices are the SmartThings devices by ID, listed once to apply the
+	// device filters
+	devices map[uuid.UUID]smartthings.Device
+	// series is the last reading imported of each series by dry run and
+	// the names of the recorders it was imported to
+	series map[string]map[string]seriesState
+}
+
+// Import writes archived data points with the monitor recorders and
+// returns how many were written. When names are given only the recorders
+// with those names are written. Recorders are flushed so the points are
+// stored when it returns. On dry run nothing is written and the count is
+// of the points that would be.
+//
+// Points are selected as the monitor would have recorded them: readings
+// of capabilities not monitored, of attributes the capability does not
+// record and of devices the device filters exclude are skipped. When no
+// capability is monitored readings of all of them are kept. Readings
+// repeating the timestamp of the previous one, or within the deadband, of
+// the settings of the device are skipped too. Events are kept for the
+// devices included.
+func (mon Monitor) Import(datapoints []DeviceDataPoint, dryRun bool, names ...string) (int, error) {
+	records := make([]DeviceDataPoint, 0, len(datapoints))
+
+	// Recorders imported separately each get the readings selected for
+	// them, a dry run does not change what is selected afterwards
+	key := fmt.Sprint(dryRun, "\x00", strings.Join(names, "\x00"))
+	series, ok := mon.imports.series[key]
+	if !ok {
+		series = make(map[string]seriesState)
+		mon.imports.series[key] = series
+	}
+
+	for _, dp := range datapoints {
+		included, err := mon.importIncluded(dp)
+		if err != nil {
+			return 0, err
+		}
+		if !included {
+			continue
+		}
+
+		event := dp.Key == SensorStaleMeasurement || dp.Key == InventoryChangeMeasurement
+		if !event {
+			if len(mon.capabilities) > 0 {
+				mc, ok := mon.capabilities[dp.Capability]
+				if !ok || !mc.Records(dp.Key) {
+					continue
+				}
+			}
+			if mon.importSkips(series, dp) {
+				continue
+			}
+		}
+
+		records = append(records, dp)
+	}
+
+	if dryRun || len(records) == 0 {
+		return len(records), nil
+	}
+
+	recorders, err := mon.namedRecorders(names)
+	if err != nil {
+		return 0, err
+	}
+
+	err = recorders.Add(records)
+	if err == nil {
+		err = recorders.Flush()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not import points: %w", err)
+	}
+
+	return len(records), nil
+}
+
+// RecorderNames returns the names of the monitor recorders.
+func (mon Monitor) RecorderNames() []string {
+	names := make([]string, 0, len(mon.sinks))
+	for _, s := range mon.sinks {
+		names = append(names, s.Name)
+	}
+
+	return names
+}
+
+// namedRecorders returns the recorders with the names, all when none is
+// given.
+func (mon Monitor) namedRecorders(names []string) (MultiRecorder, error) {
+	if len(names) == 0 {
+		return mon.recorders(), nil
+	}
+
+	recorders := MultiRecorder{}
+	for _, name := range names {
+		found := false
+		for _, s := range mon.sinks {
+			if s.Name == name {
+				recorders = append(recorders, s.NamedRecorder)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no recorder named %s", name)
+		}
+	}
+
+	return recorders, nil
+}
+
+// importIncluded tells if the device of the archived point passes the
+// device filters. Devices still in SmartThings are matched with all their
+// details, removed ones with the ones the point keeps.
+func (mon Monitor) importIncluded(dp DeviceDataPoint) (bool, error) {
+	if mon.filters.Include.IsEmpty() && mon.filters.Exclude.IsEmpty() {
+		return true, nil
+	}
+
+	if mon.imports.devices == nil {
+		if mon.client == nil {
+			return false, errors.New("device filters need the SmartThings client, set the api token")
+		}
+
+		list, err := mon.client.Devices()
+		if err != nil {
+			return false, fmt.Errorf("could not list devices to apply the device filters: %w", err)
+		}
+
+		mon.imports.devices = make(map[uuid.UUID]smartthings.Device, len(list.Items))
+		for _, d := range list.Items {
+			mon.imports.devices[d.DeviceId] = d
+		}
+	}
+
+	d, ok := mon.imports.devices[dp.DeviceId]
+	if !ok {
+		d = smartthings.Device{DeviceId: dp.DeviceId, Label: dp.Device}
+	}
+
+	return mon.filters.Includes(d, dp.Room), nil
+}
+
+// importSkips tells if the archived reading is skipped by the dedup or
+// deadband of the device settings, keeping it as the last of its series
+// otherwise.
+func (mon Monitor) importSkips(series map[string]seriesState, dp DeviceDataPoint) bool {
+	settings := mon.settings(dp.DeviceId, dp.Device, dp.Capability)
+	state, known := series[dp.series()]
+
+	if known && !dp.Heartbeat {
+		if settings.Dedup && state.timestamp.Equal(dp.Timestamp) {
+			return true
+		}
+
+		if !settings.Deadband.IsEmpty() && settings.Deadband.Suppresses(state.value, dp.Value) &&
+			(settings.Deadband.MaxSilence <= 0 || dp.Timestamp.Sub(state.written) < settings.Deadband.MaxSilence) {
+			return true
+		}
+	}
+
+	// Heartbeats do not move the reading, as when recorded
+	state.written = dp.Timestamp
+	if !dp.Heartbeat {
+		state.timestamp = dp.Timestamp
+		state.value = dp.Value
+	}
+	series[dp.series()] = state
+
+	return false
+}
@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
+	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+	"github.com/google/uuid"
+)
+
+// InventoryChangeMeasurement is the measurement recording changes on the
+// SmartThings device inventory. The kind of change is on the event tag.
+const InventoryChangeMeasurement = "inventoryChange"
+
+const (
+	DeviceAdded       = "added"
+	DeviceRemoved     = "removed"
+	DeviceRelabeled   = "relabeled"
+	CapabilityAdded   = "capabilityAdded"
+	CapabilityRemoved = "capabilityRemoved"
+)
+
+type componentCapability struct {
+	Component  string
+	Capability string
+}
+
+// inventoryDevice is what is kept about a device to detect changes.
+type inventoryDevice struct {
+	label        string
+	capabilities map[componentCapability]bool
+}
+
+// deviceInventory is the device inventory known from the last cycle
+// and the cached device list it was built from.
+type deviceInventory struct {
+	loaded  bool
+	devices map[uuid.UUID]inventoryDevice
+	list    smartthings.DevicesList
+	fetched time.Time
+	// rooms are the room names by room, refreshed with the device list
+	// when it is cached
+	rooms map[uuid.UUID]string
+	// roomsFailed are the locations whose rooms could not be listed, not
+	// listed again until the device list is refreshed
+	roomsFailed map[uuid.UUID]bool
+	// invalid forces the device list to be fetched at the next cycle
+	invalid atomic.Bool
+}
+
+// deviceList returns the SmartThings device list, fetching it from the
+// client when the cached one is older than refresh or was invalidated.
+func (inv *deviceInventory) deviceList(client smartthings.Client, refresh time.Duration, now time.Time) (smartthings.DevicesList, error) {
+	invalid := inv.invalid.Load()
+	if inv.fetched.IsZero() || refresh <= 0 || now.Sub(inv.fetched) >= refresh || invalid {
+		list, err := client.Devices()
+		if err != nil {
+			return list, err
+		}
+
+		if !inv.fetched.IsZero() && refresh > 0 {
+			log.Printf("Device inventory refreshed, previous one from %s", inv.fetched)
+		}
+
+		// Rooms are refreshed with the cached list, a list fetched every
+		// cycle only gets the rooms not known yet
+		if refresh > 0 || invalid {
+			clear(inv.rooms)
+			clear(inv.roomsFailed)
+		}
+
+		inv.list = list
+		inv.fetched = now
+		inv.invalid.Store(false)
+		metrics.ObserveInventory(now)
+	}
+
+	return inv.list, nil
+}
+
+// invalidate forces the device list to be fetched at the next cycle.
+func (inv *deviceInventory) invalidate() {
+	inv.invalid.Store(true)
+}
+
+// changes returns inventoryChange points for the differences between
+// the known inventory and the device list. The first inventory loaded is
+// the baseline and produces no changes.
+func (inv *deviceInventory) changes(list smartthings.DevicesList, now time.Time) []DeviceDataPoint {
+	events := []DeviceDataPoint{}
+	if !inv.loaded {
+		return events
+	}
+
+	event := func(kind string, id uuid.UUID, label string, cc componentCapability) DeviceDataPoint {
+		return DeviceDataPoint{
+			Key:        InventoryChangeMeasurement,
+			DeviceId:   id,
+			Device:     label,
+			Component:  cc.Component,
+			Capability: cc.Capability,
+			Value:      1,
+			Timestamp:  now,
+			Tags:       map[string]string{"event": kind},
+		}
+	}
+
+	current := map[uuid.UUID]bool{}
+	for _, d := range list.Items {
+		current[d.DeviceId] = true
+		known, ok := inv.devices[d.DeviceId]
+		caps := deviceCapabilities(d)
+
+		if !ok {
+			events = append(events, event(DeviceAdded, d.DeviceId, d.Label, componentCapability{}))
+
+			continue
+		}
+
+		if known.label != d.Label {
+			ev := event(DeviceRelabeled, d.DeviceId, d.Label, componentCapability{})
+			ev.Tags["previous"] = known.label
+			events = append(events, ev)
+		}
+
+		for _, cc := range sortedCapabilities(caps) {
+			if !known.capabilities[cc] {
+				events = append(events, event(CapabilityAdded, d.DeviceId, d.Label, cc))
+			}
+		}
+
+		for _, cc := range sortedCapabilities(known.capabilities) {
+			if !caps[cc] {
+				events = append(events, event(CapabilityRemoved, d.DeviceId, d.Label, cc))
+			}
+		}
+	}
+
+	removed := []uuid.UUID{}
+	for id := range inv.devices {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].String() < removed[j].String() })
+
+	for _, id := range removed {
+		events = append(events, event(DeviceRemoved, id, inv.devices[id].label, componentCapability{}))
+	}
+
+	return events
+}
+
+// update replaces the known inventory with the device list logging the
+// changes found on it.
+func (inv *deviceInventory) update(list smartthings.DevicesList, events []DeviceDataPoint) {
+	for _, ev := range events {
+		log.Printf("Inventory change: %s device %s[%s] %s %s", ev.Tags["event"], ev.Device, ev.DeviceId, ev.Component, ev.Capability)
+	}
+
+	for id := range inv.devices {
+		delete(inv.devices, id)
+	}
+
+	for _, d := range list.Items {
+		inv.devices[d.DeviceId] = inventoryDevice{label: d.Label, capabilities: deviceCapabilities(d)}
+	}
+
+	inv.loaded = true
+}
+
+func deviceCapabilities(d smartthings.Device) map[componentCapability]bool {
+	caps := map[componentCapability]bool{}
+
+	for _, comp := range d.Components {
+		for _, cap := range comp.Capabilities {
+			caps[componentCapability{Component: comp.Id, Capability: cap.Id}] = true
+		}
+	}
+
+	return caps
+}
+
+func sortedCapabilities(caps map[componentCapability]bool) []componentCapability {
+	list := make([]componentCapability, 0, len(caps))
+	for cc := range caps {
+		list = append(list, cc)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Component != list[j].Component {
+			return list[i].Component < list[j].Component
+		}
+		return list[i].Capability < list[j].Capability
+	})
+
+	return list
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/smartthings"
+	"github.com/google/uuid"
+)
+
+func TestDeviceInventory_changes(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+	lamp := uuid.MustParse("f33840a1-f835-41ff-b8f8-b8c95d768363")
+	sensor := uuid.MustParse("27118afd-2f98-425c-8211-899eb596edad")
+	plug := uuid.MustParse("99e5de18-3fbc-4769-a83e-e466a8564f6d")
+
+	device := func(id uuid.UUID, label string, caps ...string) smartthings.Device {
+		d := smartthings.Device{DeviceId: id, Label: label, Components: []smartthings.Component{{Id: "main"}}}
+		for _, c := range caps {
+			d.Components[0].Capabilities = append(d.Components[0].Capabilities, smartthings.Capability{Id: c})
+		}
+		return d
+	}
+
+	baseline := smartthings.DevicesList{Items: []smartthings.Device{
+		device(lamp, "Lamp", "switch", "switchLevel"),
+		device(sensor, "Sensor", "temperatureMeasurement"),
+	}}
+
+	type change struct {
+		kind       string
+		device     string
+		capability string
+	}
+
+	tests := []struct {
+		name string
+		list smartthings.DevicesList
+		want []change
+	}{
+		{name: "no changes", list: baseline, want: []change{}},
+		{
+			name: "added and removed",
+			list: smartthings.DevicesList{Items: []smartthings.Device{
+				device(lamp, "Lamp", "switch", "switchLevel"),
+				device(plug, "Plug", "powerMeter"),
+			}},
+			want: []change{{DeviceAdded, "Plug", ""}, {DeviceRemoved, "Sensor", ""}},
+		},
+		{
+			name: "relabeled and capabilities",
+			list: smartthings.DevicesList{Items: []smartthings.Device{
+				device(lamp, "Floor Lamp", "switch", "colorControl"),
+				device(sensor, "Sensor", "temperatureMeasurement"),
+			}},
+			want: []change{{DeviceRelabeled, "Floor Lamp", ""}, {CapabilityAdded, "Floor Lamp", "colorControl"}, {CapabilityRemoved, "Floor Lamp", "switchLevel"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := &deviceInventory{devices: map[uuid.UUID]inventoryDevice{}}
+
+			if got := inv.changes(baseline, now); len(got) != 0 {
+				t.Fatalf("deviceInventory.changes() on first load = %v, want none", got)
+			}
+			inv.update(baseline, nil)
+
+			got := []change{}
+			for _, ev := range inv.changes(tt.list, now) {
+				if ev.Key != InventoryChangeMeasurement || !ev.Timestamp.Equal(now) {
+					t.Errorf("deviceInventory.changes() unexpected point %v", ev)
+				}
+				got = append(got, change{ev.Tags["event"], ev.Device, ev.Capability})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deviceInventory.changes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,145 +1,324 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
 	"github.com/eargollo/smartthings-influx/pkg/smartthings"
 )
 
 type Monitor struct {
-	period       time.Duration
-	client       smartthings.Client
-	recorder     Recorder
-	lastUpdate   map[uuid.UUID]time.Time
+	period    time.Duration
+	client    smartthings.Client
+	sinks     []*sink
+	inventory *deviceInventory
+	// inventoryRefresh is how long the device list is cached
+	inventoryRefresh time.Duration
+	// writeTimeout bounds the write to each sink
+	writeTimeout time.Duration
+	health       *health
+	nextDue      map[string]time.Time
 	clock        Clock
 	capabilities map[string]*MonitorCapability
 	converter    ConversionMap
+	filters      DeviceFilters
+	overrides    DeviceOverrides
+	warnings     map[string]bool
+	// stale is the staleness of the readings as last logged
+	stale   map[string]bool
+	imports *importState
 }
 
 // New creates a new monitor that will add read data from the client
-// and add to the recorder. If no recorder is passed as options
+// and add to the recorders. If no recorder is passed as options
 // stdout is used.
 func New(opts ...MonitorOption) *Monitor {
 	// Monitor with defaults
 	mon := &Monitor{
-		recorder: &StdOutRecorder{},
-		clock:    &realClock{},
-		period:   10 * time.Second,
+		clock:        &realClock{},
+		period:       10 * time.Second,
+		writeTimeout: time.Minute,
 	}
 
-	mon.lastUpdate = make(map[uuid.UUID]time.Time)
+	mon.inventory = &deviceInventory{
+		devices:     make(map[uuid.UUID]inventoryDevice),
+		rooms:       make(map[uuid.UUID]string),
+		roomsFailed: make(map[uuid.UUID]bool),
+	}
+	mon.health = &health{}
+	mon.nextDue = make(map[string]time.Time)
 	mon.capabilities = make(map[string]*MonitorCapability)
+	mon.warnings = make(map[string]bool)
+	mon.stale = make(map[string]bool)
+	mon.imports = &importState{series: make(map[string]map[string]seriesState)}
 
 	for _, opt := range opts {
 		opt(mon)
 	}
 
+	if len(mon.sinks) == 0 {
+		mon.sinks = []*sink{newSink("stdout", &StdOutRecorder{})}
+	}
+
 	return mon
 }
 
+// Run monitors until the process ends.
 func (mon Monitor) Run() error {
+	return mon.RunContext(context.Background())
+}
+
+// RunContext opens the recorders and monitors until ctx is done, then
+// flushes and closes the recorders. Recorders that can't be reached are
+// logged and opened again at the next cycle, the monitor is not ready
+// until they are. Recorders with wrong settings stop the monitor with
+// their error.
+func (mon Monitor) RunContext(ctx context.Context) error {
+	err := mon.Open()
+	if IsConfigError(err) {
+		return mon.stop(fmt.Errorf("could not open recorders: %w", err))
+	}
+	mon.health.recorder(err)
+	if err != nil {
+		log.Printf("ERROR: could not open recorders, will retry at next cycle: %v", err)
+	}
+
+	mon.health.start(mon.clock.Now())
+
 	// Cheap trick not to sleep at the first round
 	duration := time.Duration(0)
 
 	for {
 		// Cheap trick not to sleep at the first round
-		time.Sleep(duration)
-		duration = time.Duration(mon.period)
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopping monitor")
+
+			return mon.stop(nil)
+		case <-time.After(duration):
+		}
 		// End of cheap trick
 
-		dataPoints, err := mon.InspectDevices()
+		start := time.Now()
+		err := mon.CycleContext(ctx)
+		metrics.CycleDuration.Observe(time.Since(start).Seconds())
+		duration = mon.untilNextDue()
+		if IsConfigError(err) {
+			return mon.stop(err)
+		}
 		if err != nil {
-			log.Printf("ERROR: Could not gather devices data: %v", err)
-
-			continue
+			log.Printf("ERROR: %v", err)
 		}
+	}
+}
 
-		// Using another map so we update the timestamp only when the record is serialized
-		newLastUpdate := make(map[uuid.UUID]time.Time)
+// stop closes the recorders returning err along with the close error.
+func (mon Monitor) stop(err error) error {
+	if cerr := mon.Close(); cerr != nil {
+		err = errors.Join(err, fmt.Errorf("could not close recorders: %w", cerr))
+	}
 
-		if len(dataPoints) == 0 {
-			log.Printf("ERROR: no devices with any of the capabilities: %s", strings.Join(mon.CapabilityNames(), ", "))
+	return err
+}
 
-			continue
-		}
+// Cycle runs a single monitoring pass: polls the capabilities due for
+// polling and records the data points that changed since last record
+// along with inventory and staleness events.
+func (mon Monitor) Cycle() error {
+	return mon.CycleContext(context.Background())
+}
 
-		updateDataPoints := []DeviceDataPoint{}
-		// Check which devices measurements were updated since last time
-		for _, dp := range dataPoints {
-			if mon.lastUpdate[dp.DeviceId] != dp.Timestamp {
-				// Device updated, add to the update list
-				updateDataPoints = append(updateDataPoints, dp)
-			} else {
-				log.Printf("No changes since last query for device %s[%s]. Skipping.", dp.Device, dp.DeviceId)
-			}
-			newLastUpdate[dp.DeviceId] = dp.Timestamp
+// CycleContext is Cycle giving up waiting for the recorders when ctx is
+// done, so the monitor can stop while a recorder retries.
+func (mon Monitor) CycleContext(ctx context.Context) error {
+	err := mon.cycle(ctx)
+	if err == nil {
+		mon.health.cycleCompleted(mon.clock.Now())
+	}
+
+	return err
+}
+
+func (mon Monitor) cycle(ctx context.Context) error {
+	if mon.client == nil {
+		return fmt.Errorf("Can't connect to SmartThings, client not configured")
+	}
+
+	now := mon.clock.Now()
+
+	list, err := mon.inventory.deviceList(mon.client, mon.inventoryRefresh, now)
+	mon.health.smartThings(err)
+	if err != nil {
+		return fmt.Errorf("could not list devices %v", err)
+	}
+
+	inventoryEvents := mon.inventory.changes(list, now)
+	// Sinks keep the events until recorded to them
+	mon.inventory.update(list, inventoryEvents)
+
+	devices := mon.withCapabilities(list)
+	mon.unschedule(devices)
+
+	dataPoints, err := mon.inspect(devices, true)
+	if err != nil {
+		return fmt.Errorf("could not gather devices data: %w", err)
+	}
+
+	if len(dataPoints) == 0 {
+		log.Printf("No capabilities due for polling")
+	}
+	mon.logStale(dataPoints, now)
+
+	// Sinks are written concurrently each within its own timeout, a failing
+	// or slow sink does not hold the others back
+	saved := make([][]DeviceDataPoint, len(mon.sinks))
+	errs := make([]error, len(mon.sinks))
+	var wg sync.WaitGroup
+	for i, s := range mon.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, mon.writeTimeout)
+			defer cancel()
+			// Skips are the same for all sinks in sync, log them once
+			saved[i], errs[i] = mon.record(ctx, s, dataPoints, inventoryEvents, now, i == 0)
+		}()
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	mon.health.recorder(err)
+
+	updates, written := savedUpdates(saved)
+	if written {
+		log.Printf("Record saved %v", updates)
+	} else if err == nil {
+		log.Printf("No new data since last update")
+	}
+	if err != nil {
+		return fmt.Errorf("monitor got error writing point: %w", err)
+	}
+
+	return nil
+}
+
+// savedUpdates merges the updates saved to each sink, an update saved to
+// several sinks is listed once. It tells if any sink was written, a sink
+// not written has no updates list.
+func savedUpdates(saved [][]DeviceDataPoint) ([]DeviceDataPoint, bool) {
+	updates := []DeviceDataPoint{}
+	seen := make(map[string]bool)
+	written := false
+
+	for _, sinkUpdates := range saved {
+		if sinkUpdates == nil {
+			continue
 		}
+		written = true
 
-		if len(updateDataPoints) > 0 {
-			err = mon.recorder.Add(updateDataPoints)
-			if err != nil {
-				log.Printf("Monitor got error writing point: %v", err)
-			} else {
-				log.Printf("Record saved %v", dataPoints)
-				// Replace last update timestamps
-				mon.lastUpdate = newLastUpdate
+		for _, dp := range sinkUpdates {
+			key := dp.series() + "/" + dp.Timestamp.String()
+			if seen[key] {
+				continue
 			}
-		} else {
-			log.Printf("No new data since last update")
+			seen[key] = true
+			updates = append(updates, dp)
 		}
 	}
+
+	return updates, written
 }
 
-func (mon Monitor) InspectDevices() ([]DeviceDataPoint, error) {
-	currentTime := mon.clock.Now()
-	dataPoints := []DeviceDataPoint{}
+// RefreshInventory forces the device list to be fetched from SmartThings
+// at the next cycle. It is safe to call from other goroutines.
+func (mon Monitor) RefreshInventory() {
+	mon.inventory.invalidate()
+}
 
+// InspectDevices polls all monitored capabilities of all devices and
+// returns their data points. Polled capabilities are scheduled for their
+// next poll.
+func (mon Monitor) InspectDevices() ([]DeviceDataPoint, error) {
 	if mon.client == nil {
-		return dataPoints, fmt.Errorf("Can't connect to SmartThings, client not configured")
+		return []DeviceDataPoint{}, fmt.Errorf("Can't connect to SmartThings, client not configured")
 	}
 
 	// List devices with metrics
-
 	devices, err := mon.DevicesWithCapabilities()
 	if err != nil {
-		return dataPoints, fmt.Errorf("could not list devices %v", err)
+		return []DeviceDataPoint{}, fmt.Errorf("could not list devices %v", err)
 	}
 
+	return mon.inspect(devices, false)
+}
+
+// inspect polls the monitored capabilities of the devices. If dueOnly is
+// set only capabilities due for polling are polled.
+func (mon Monitor) inspect(devices []deviceWithCapability, dueOnly bool) ([]DeviceDataPoint, error) {
+	currentTime := mon.clock.Now()
+	dataPoints := []DeviceDataPoint{}
+
 	if len(devices) == 0 {
 		log.Printf("no devices with any of the metrics: %s", strings.Join(mon.CapabilityNames(), ", "))
 		return dataPoints, nil
 	}
 
 	for i, dev := range devices {
+		if dueOnly && !mon.due(dev, currentTime) {
+			continue
+		}
+
 		log.Printf("%d: Monitoring '%s' from device '%s' (%s)", i, dev.CapabilityId, dev.DeviceLabel, dev.DeviceId)
 
 		// Get measurement
 		status, err := mon.client.DeviceCapabilityStatus(dev.DeviceId, dev.ComponentId, dev.CapabilityId)
 		if err != nil {
 			log.Printf("ERROR: could not get metric status: %v", err)
+			mon.retry(dev, currentTime)
+			if smartthings.IsNotFound(err) {
+				// Device or capability may be gone, refresh devices at next cycle
+				mon.inventory.invalidate()
+			}
 			continue
 		}
 
+		mon.schedule(dev, currentTime)
+
+		mc, ok := mon.capabilities[dev.CapabilityId]
+		if ok {
+			mon.validateAttributes(mc, status)
+		}
+
+		settings := mon.settings(dev.DeviceId, dev.DeviceLabel, dev.CapabilityId)
+
 		for key, val := range status {
+			if ok && !mc.Records(key) {
+				continue
+			}
+
 			if val.Value == nil {
 				log.Printf("WARNING: Got nil metric value: %v", err)
 				continue
 			}
 
 			// Get converted value
-			convValue, err := mon.converter.Convert(key, val.Value)
+			convValue, err := settings.Converter.Convert(key, val.Value)
 			if err != nil {
 				log.Printf("ERROR: could not convert to number %v", err)
+				metrics.ConversionErrors.WithLabelValues(dev.CapabilityId, key).Inc()
 				continue
 			}
 
 			readTime := val.Timestamp
-			mc, ok := mon.capabilities[dev.CapabilityId]
 
 			// log.Printf("Key %s Device ID %s Device %s Component %s Capability %s Value %v number value %f mc %s, ok %v config %v",
 			// 	key,
@@ -154,12 +333,10 @@ func (mon Monitor) InspectDevices() ([]DeviceDataPoint, error) {
 			// 	mon.capabilities,
 			// )
 
-			if ok {
-				if mc.Time == WallTime {
-					readTime = currentTime
-					log.Printf("Device %s is set to wall time. Device read time %s replaced bt %s.",
-						dev.DeviceLabel, val.Timestamp.String(), readTime.String())
-				}
+			if settings.Time == WallTime {
+				readTime = currentTime
+				log.Printf("Device %s is set to wall time. Device read time %s replaced bt %s.",
+					dev.DeviceLabel, val.Timestamp.String(), readTime.String())
 			}
 
 			// Create point
@@ -167,11 +344,18 @@ func (mon Monitor) InspectDevices() ([]DeviceDataPoint, error) {
 				Key:        key,
 				DeviceId:   dev.DeviceId,
 				Device:     dev.DeviceLabel,
+				Room:       dev.Room,
 				Component:  dev.ComponentId,
 				Capability: dev.CapabilityId,
 				Unit:       val.Unit,
 				Value:      convValue,
 				Timestamp:  readTime,
+				SensorTime: val.Timestamp,
+			}
+
+			if settings.Time == BothTimes {
+				point.PolledAt = currentTime
+				point.Age = currentTime.Sub(val.Timestamp)
 			}
 
 			dataPoints = append(dataPoints, point)
@@ -181,34 +365,108 @@ func (mon Monitor) InspectDevices() ([]DeviceDataPoint, error) {
 	return dataPoints, nil
 }
 
+// validateAttributes warns, once per capability and attribute, about
+// configured attribute names the device does not report.
+func (mon Monitor) validateAttributes(mc *MonitorCapability, status map[string]smartthings.CapabilityStatus) {
+	reported := make([]string, 0, len(status))
+	for key := range status {
+		reported = append(reported, key)
+	}
+	sort.Strings(reported)
+
+	for _, name := range mc.UnknownAttributes(reported) {
+		warning := mc.Name + "." + name
+		if mon.warnings[warning] {
+			continue
+		}
+		mon.warnings[warning] = true
+		log.Printf("WARNING: capability '%s' does not report attribute '%s' configured in attributes/exclude_attributes, reported attributes are: %s",
+			mc.Name, name, strings.Join(reported, ", "))
+	}
+}
+
 type deviceWithCapability struct {
 	DeviceId     uuid.UUID
 	DeviceLabel  string
+	Room         string
 	ComponentId  string
 	CapabilityId string
 }
 
 func (mon Monitor) DevicesWithCapabilities() ([]deviceWithCapability, error) {
-	list := []deviceWithCapability{}
-
 	devices, err := mon.client.Devices()
 	if err != nil {
-		return list, err
+		return []deviceWithCapability{}, err
 	}
 
+	return mon.withCapabilities(devices), nil
+}
+
+// withCapabilities lists the monitored capabilities of the devices that
+// pass the device filters.
+func (mon Monitor) withCapabilities(devices smartthings.DevicesList) []deviceWithCapability {
+	list := []deviceWithCapability{}
+
 	for _, d := range devices.Items {
+		room := mon.RoomName(d)
+		if !mon.filters.Includes(d, room) {
+			continue
+		}
+
 		for _, comp := range d.Components {
 			for _, cap := range comp.Capabilities {
 				_, ok := mon.capabilities[cap.Id]
 				if ok {
 					// Capability is being monitored
-					list = append(list, deviceWithCapability{DeviceId: d.DeviceId, DeviceLabel: d.Label, ComponentId: comp.Id, CapabilityId: cap.Id})
+					list = append(list, deviceWithCapability{DeviceId: d.DeviceId, DeviceLabel: d.Label, Room: room, ComponentId: comp.Id, CapabilityId: cap.Id})
 				}
 			}
 		}
 	}
 
-	return list, nil
+	return list
+}
+
+// DeviceIncluded tells if the device passes the configured device filters.
+func (mon Monitor) DeviceIncluded(d smartthings.Device) bool {
+	return mon.filters.Includes(d, mon.RoomName(d))
+}
+
+// RoomName returns the name of the room the device is in. Rooms are
+// queried once per location and kept in memory until the device list is
+// refreshed, only rooms not known are queried in between. A location
+// whose rooms can't be listed is logged once and not queried again until
+// the device list is refreshed.
+func (mon Monitor) RoomName(d smartthings.Device) string {
+	if d.RoomId == uuid.Nil || mon.client == nil {
+		return ""
+	}
+
+	if name, ok := mon.inventory.rooms[d.RoomId]; ok {
+		return name
+	}
+
+	if mon.inventory.roomsFailed[d.LocationId] {
+		return ""
+	}
+
+	rooms, err := mon.client.Rooms(d.LocationId)
+	if err != nil {
+		log.Printf("WARNING: could not list rooms for location %s, devices get no room until the device list is refreshed: %v", d.LocationId, err)
+		mon.inventory.roomsFailed[d.LocationId] = true
+
+		return ""
+	}
+
+	for _, r := range rooms.Items {
+		mon.inventory.rooms[r.RoomId] = r.Name
+	}
+	// A room missing from its location is not queried again either
+	if _, ok := mon.inventory.rooms[d.RoomId]; !ok {
+		mon.inventory.rooms[d.RoomId] = ""
+	}
+
+	return mon.inventory.rooms[d.RoomId]
 }
 
 func (mon Monitor) CapabilityNames() []string {
@@ -1,7 +1,10 @@
 package monitor_test
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,6 +33,11 @@ func (m *MockedSTClient) DeviceCapabilityStatus(deviceID uuid.UUID, componentId
 	return args.Get(0).(map[string]smartthings.CapabilityStatus), args.Error(1)
 }
 
+func (m *MockedSTClient) Rooms(locationID uuid.UUID) (smartthings.RoomsList, error) {
+	args := m.Called(locationID)
+	return args.Get(0).(smartthings.RoomsList), args.Error(1)
+}
+
 type MockedClock struct {
 	mock.Mock
 }
@@ -119,6 +127,49 @@ func TestMonitor_InspectDevices(t *testing.T) {
 		nil,
 	)
 
+	test3Obj := new(MockedSTClient)
+
+	test3Obj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Name:     "Thermostat",
+					Label:    "Hallway Thermostat",
+					Components: []smartthings.Component{
+						{
+							Id:    "main",
+							Label: "main",
+							Capabilities: []smartthings.Capability{
+								{
+									Id:      "thermostatCoolingSetpoint",
+									Version: 1,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		nil,
+	)
+
+	test3Obj.On("DeviceCapabilityStatus", id1, "main", "thermostatCoolingSetpoint").Return(
+		map[string]smartthings.CapabilityStatus{
+			"coolingSetpoint": {
+				Timestamp: ts,
+				Unit:      "C",
+				Value:     tempValue,
+			},
+			"coolingSetpointRange": {
+				Timestamp: ts,
+				Unit:      "C",
+				Value:     map[string]any{"minimum": 10.0, "maximum": 35.0},
+			},
+		},
+		nil,
+	)
+
 	tests := []struct {
 		name    string
 		mon     *monitor.Monitor
@@ -144,6 +195,7 @@ func TestMonitor_InspectDevices(t *testing.T) {
 					Value:      tempValue,
 					Unit:       "C",
 					Timestamp:  ts,
+					SensorTime: ts,
 				},
 			},
 			wantErr: false,
@@ -169,6 +221,53 @@ func TestMonitor_InspectDevices(t *testing.T) {
 					Capability: "carbonMonoxideDetector",
 					Value:      0.0,
 					Timestamp:  ts,
+					SensorTime: ts,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Allowed attributes",
+			mon: monitor.New(
+				monitor.SetClient(test3Obj),
+				monitor.Capabilities(monitor.MonitorCapabilities{
+					monitor.MonitorCapability{Name: "thermostatCoolingSetpoint", Time: monitor.SensorTime, Attributes: []string{"coolingSetpoint", "unknown"}},
+				}),
+			),
+			want: []monitor.DeviceDataPoint{
+				{
+					Key:        "coolingSetpoint",
+					DeviceId:   id1,
+					Device:     "Hallway Thermostat",
+					Component:  "main",
+					Capability: "thermostatCoolingSetpoint",
+					Value:      tempValue,
+					Unit:       "C",
+					Timestamp:  ts,
+					SensorTime: ts,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Excluded attributes",
+			mon: monitor.New(
+				monitor.SetClient(test3Obj),
+				monitor.Capabilities(monitor.MonitorCapabilities{
+					monitor.MonitorCapability{Name: "thermostatCoolingSetpoint", Time: monitor.SensorTime, ExcludeAttributes: []string{"coolingsetpointrange"}},
+				}),
+			),
+			want: []monitor.DeviceDataPoint{
+				{
+					Key:        "coolingSetpoint",
+					DeviceId:   id1,
+					Device:     "Hallway Thermostat",
+					Component:  "main",
+					Capability: "thermostatCoolingSetpoint",
+					Value:      tempValue,
+					Unit:       "C",
+					Timestamp:  ts,
+					SensorTime: ts,
 				},
 			},
 			wantErr: false,
@@ -268,6 +367,39 @@ func TestMonitor_CallTime(t *testing.T) {
 					Value:      tempValue,
 					Unit:       "C",
 					Timestamp:  readTime,
+					SensorTime: sensorTime,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Both times",
+			mon: monitor.New(
+				monitor.SetClient(testObj),
+				monitor.Capabilities(
+					monitor.MonitorCapabilities{
+						monitor.MonitorCapability{
+							Name: "temperatureMeasurement",
+							Time: monitor.BothTimes,
+						},
+					},
+				),
+				monitor.WithClock(clockObj),
+				monitor.WithPeriod(100*time.Second),
+			),
+			want: []monitor.DeviceDataPoint{
+				{
+					Key:        "temperature",
+					DeviceId:   id1,
+					Device:     "Mocked Device",
+					Component:  "main",
+					Capability: "temperatureMeasurement",
+					Value:      tempValue,
+					Unit:       "C",
+					Timestamp:  sensorTime,
+					SensorTime: sensorTime,
+					PolledAt:   readTime,
+					Age:        readTime.Sub(sensorTime),
 				},
 			},
 			wantErr: false,
@@ -287,3 +419,1234 @@ func TestMonitor_CallTime(t *testing.T) {
 		})
 	}
 }
+
+func TestMonitor_DeviceFilters(t *testing.T) {
+	id1 := uuid.New()
+	id2 := uuid.New()
+	locationId := uuid.New()
+	kitchen := uuid.New()
+	office := uuid.New()
+	ts, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+
+	testObj := new(MockedSTClient)
+
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId:   id1,
+					Name:       "Mocked Sensor",
+					Label:      "Kitchen Sensor",
+					LocationId: locationId,
+					RoomId:     kitchen,
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+				{
+					DeviceId:   id2,
+					Name:       "Mocked Sensor",
+					Label:      "Test Sensor",
+					LocationId: locationId,
+					RoomId:     office,
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+
+	testObj.On("Rooms", locationId).Return(
+		smartthings.RoomsList{
+			Items: []smartthings.Room{
+				{RoomId: kitchen, LocationId: locationId, Name: "Kitchen"},
+				{RoomId: office, LocationId: locationId, Name: "Office"},
+			},
+		},
+		nil,
+	).Once()
+
+	testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+		map[string]smartthings.CapabilityStatus{
+			"temperature": {Timestamp: ts, Unit: "C", Value: 20.0},
+		},
+		nil,
+	)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime},
+		}),
+		monitor.WithDeviceFilters(monitor.DeviceFilters{
+			Include: monitor.DeviceFilter{Rooms: []string{"kitchen", "office"}},
+			Exclude: monitor.DeviceFilter{Labels: []string{"Test *"}},
+		}),
+	)
+
+	want := []monitor.DeviceDataPoint{
+		{
+			Key:        "temperature",
+			DeviceId:   id1,
+			Device:     "Kitchen Sensor",
+			Component:  "main",
+			Capability: "temperatureMeasurement",
+			Value:      20.0,
+			Unit:       "C",
+			Timestamp:  ts,
+			SensorTime: ts,
+			Room:       "Kitchen",
+		},
+	}
+
+	got, err := mon.InspectDevices()
+	if err != nil {
+		t.Fatalf("Monitor.InspectDevices() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Monitor.InspectDevices() = %v, want %v", got, want)
+	}
+
+	testObj.AssertExpectations(t)
+}
+
+func TestMonitor_RoomName(t *testing.T) {
+	id1 := uuid.New()
+	id2 := uuid.New()
+	locationId := uuid.New()
+	kitchen := uuid.New()
+	living := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	device := func(id uuid.UUID, label string, room uuid.UUID) smartthings.Device {
+		return smartthings.Device{
+			DeviceId:   id,
+			Label:      label,
+			LocationId: locationId,
+			RoomId:     room,
+			Components: []smartthings.Component{
+				{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+			},
+		}
+	}
+
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{Items: []smartthings.Device{device(id1, "Kitchen Sensor", kitchen), device(id2, "Living Sensor", living)}},
+		nil,
+	)
+	for _, id := range []uuid.UUID{id1, id2} {
+		testObj.On("DeviceCapabilityStatus", id, "main", "temperatureMeasurement").Return(
+			map[string]smartthings.CapabilityStatus{
+				"temperature": {Timestamp: start, Unit: "C", Value: 20.0},
+			},
+			nil,
+		)
+	}
+	rooms := func(name string) smartthings.RoomsList {
+		return smartthings.RoomsList{Items: []smartthings.Room{
+			{RoomId: kitchen, LocationId: locationId, Name: name},
+			{RoomId: living, LocationId: locationId, Name: "Living Room"},
+		}}
+	}
+	// Rooms are listed once per location and inventory refresh, failures
+	// included
+	testObj.On("Rooms", locationId).Return(smartthings.RoomsList{}, errors.New("403 forbidden")).Once()
+	testObj.On("Rooms", locationId).Return(rooms("Kitchen"), nil).Once()
+	testObj.On("Rooms", locationId).Return(rooms("Cooking"), nil).Once()
+
+	clockObj := new(MockedClock)
+	recorder := new(MockedRecorder)
+	recorder.On("Add", mock.Anything).Return(nil)
+	dedup := false
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.SetRecorder(recorder),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Minute),
+		monitor.WithInventoryRefresh(time.Hour),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime, Dedup: &dedup},
+		}),
+	)
+
+	steps := []struct {
+		name  string
+		after time.Duration
+		want  map[uuid.UUID]string
+	}{
+		{name: "rooms failing", after: 0, want: map[uuid.UUID]string{id1: "", id2: ""}},
+		{name: "failure kept", after: time.Minute, want: map[uuid.UUID]string{id1: "", id2: ""}},
+		{name: "rooms queried with inventory", after: time.Hour, want: map[uuid.UUID]string{id1: "Kitchen", id2: "Living Room"}},
+		{name: "rooms kept", after: time.Hour + time.Minute, want: map[uuid.UUID]string{id1: "Kitchen", id2: "Living Room"}},
+		{name: "rooms refreshed with inventory", after: 2 * time.Hour, want: map[uuid.UUID]string{id1: "Cooking", id2: "Living Room"}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+
+			got := map[uuid.UUID]string{}
+			for _, dp := range cycleRecords(t, mon, recorder) {
+				got[dp.DeviceId] = dp.Room
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("Monitor.Cycle() recorded rooms %v, want %v", got, step.want)
+			}
+		})
+	}
+
+	testObj.AssertExpectations(t)
+}
+
+func TestMonitor_RoomName_NotCached(t *testing.T) {
+	id1 := uuid.New()
+	id2 := uuid.New()
+	locationId := uuid.New()
+	kitchen := uuid.New()
+	living := uuid.New()
+
+	list := smartthings.DevicesList{Items: []smartthings.Device{
+		{DeviceId: id1, Label: "Kitchen Sensor", LocationId: locationId, RoomId: kitchen},
+	}}
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(list, nil)
+	testObj.On("Rooms", locationId).Return(
+		smartthings.RoomsList{Items: []smartthings.Room{{RoomId: kitchen, LocationId: locationId, Name: "Kitchen"}}}, nil,
+	).Once()
+	testObj.On("Rooms", locationId).Return(
+		smartthings.RoomsList{Items: []smartthings.Room{{RoomId: kitchen, LocationId: locationId, Name: "Kitchen"}, {RoomId: living, LocationId: locationId, Name: "Living Room"}}}, nil,
+	).Once()
+
+	clockObj := new(MockedClock)
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+	mon := monitor.New(monitor.SetClient(testObj), monitor.WithClock(clockObj))
+
+	// The device list fetched every cycle does not list rooms again,
+	// only a room not known yet does
+	for i := 0; i < 3; i++ {
+		setNow(clockObj, start.Add(time.Duration(i)*time.Minute))
+		if err := mon.Cycle(); err != nil {
+			t.Fatalf("Monitor.Cycle() error = %v", err)
+		}
+	}
+
+	if got := mon.RoomName(smartthings.Device{DeviceId: id2, LocationId: locationId, RoomId: living}); got != "Living Room" {
+		t.Errorf("Monitor.RoomName() = %q, want Living Room", got)
+	}
+
+	testObj.AssertExpectations(t)
+}
+
+type MockedRecorder struct {
+	mock.Mock
+}
+
+func (m *MockedRecorder) Add(dps []monitor.DeviceDataPoint) error {
+	args := m.Called(dps)
+	return args.Error(0)
+}
+
+// setNow replaces the time returned by the mocked clock
+func setNow(clock *MockedClock, now time.Time) {
+	clock.ExpectedCalls = nil
+	clock.On("Now").Return(now)
+}
+
+// cycleRecords runs a monitor cycle and returns the points recorded by it
+func cycleRecords(t *testing.T, mon *monitor.Monitor, recorder *MockedRecorder) []monitor.DeviceDataPoint {
+	calls := len(recorder.Calls)
+	if err := mon.Cycle(); err != nil {
+		t.Fatalf("Monitor.Cycle() error = %v", err)
+	}
+
+	if len(recorder.Calls) == calls {
+		return nil
+	}
+
+	return recorder.Calls[len(recorder.Calls)-1].Arguments.Get(0).([]monitor.DeviceDataPoint)
+}
+
+func TestMonitor_Heartbeat(t *testing.T) {
+	id1 := uuid.New()
+	sensorTime, _ := time.Parse(time.RFC3339, "2023-01-01T09:00:00Z")
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Label:    "Mocked Device",
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+		map[string]smartthings.CapabilityStatus{
+			"temperature": {Timestamp: sensorTime, Unit: "C", Value: 21.0},
+		},
+		nil,
+	)
+
+	clockObj := new(MockedClock)
+	recorder := new(MockedRecorder)
+	recorder.On("Add", mock.Anything).Return(nil)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.SetRecorder(recorder),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(10*time.Minute),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime, Heartbeat: time.Hour},
+		}),
+	)
+
+	reading := monitor.DeviceDataPoint{
+		Key:        "temperature",
+		DeviceId:   id1,
+		Device:     "Mocked Device",
+		Component:  "main",
+		Capability: "temperatureMeasurement",
+		Value:      21.0,
+		Unit:       "C",
+		Timestamp:  sensorTime,
+		SensorTime: sensorTime,
+	}
+	heartbeat := func(at time.Time) monitor.DeviceDataPoint {
+		dp := reading
+		dp.Timestamp = at
+		dp.Heartbeat = true
+		return dp
+	}
+
+	steps := []struct {
+		name  string
+		after time.Duration
+		want  []monitor.DeviceDataPoint
+	}{
+		{name: "first reading", after: 0, want: []monitor.DeviceDataPoint{reading}},
+		{name: "unchanged", after: 30 * time.Minute, want: nil},
+		{name: "heartbeat expired", after: 60 * time.Minute, want: []monitor.DeviceDataPoint{heartbeat(start.Add(60 * time.Minute))}},
+		{name: "unchanged after heartbeat", after: 90 * time.Minute, want: nil},
+		{name: "second heartbeat", after: 120 * time.Minute, want: []monitor.DeviceDataPoint{heartbeat(start.Add(120 * time.Minute))}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+			if got := cycleRecords(t, mon, recorder); !reflect.DeepEqual(got, step.want) {
+				t.Errorf("Monitor.Cycle() recorded %v, want %v", got, step.want)
+			}
+		})
+	}
+}
+
+func TestMonitor_Deadband(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	type reading struct {
+		after    time.Duration
+		value    float64
+		recorded bool
+	}
+
+	tests := []struct {
+		name      string
+		deadband  monitor.Deadband
+		heartbeat time.Duration
+		readings  []reading
+	}{
+		{
+			name:     "no deadband",
+			deadband: monitor.Deadband{},
+			readings: []reading{
+				{after: 0, value: 20.0, recorded: true},
+				{after: time.Minute, value: 20.1, recorded: true},
+				{after: 2 * time.Minute, value: 20.0, recorded: true},
+			},
+		},
+		{
+			name:     "absolute",
+			deadband: monitor.Deadband{Absolute: 0.5},
+			readings: []reading{
+				{after: 0, value: 20.0, recorded: true},
+				{after: time.Minute, value: 20.3, recorded: false},
+				{after: 2 * time.Minute, value: 20.6, recorded: true},
+				{after: 3 * time.Minute, value: 20.2, recorded: false},
+				{after: 4 * time.Minute, value: 19.9, recorded: true},
+			},
+		},
+		{
+			name:     "percent",
+			deadband: monitor.Deadband{Percent: 5},
+			readings: []reading{
+				{after: 0, value: 100, recorded: true},
+				{after: time.Minute, value: 104, recorded: false},
+				{after: 2 * time.Minute, value: 96, recorded: false},
+				{after: 3 * time.Minute, value: 106, recorded: true},
+			},
+		},
+		{
+			name:     "percent from zero",
+			deadband: monitor.Deadband{Percent: 5},
+			readings: []reading{
+				{after: 0, value: 0, recorded: true},
+				{after: time.Minute, value: 0.1, recorded: true},
+			},
+		},
+		{
+			name:     "max silence",
+			deadband: monitor.Deadband{Absolute: 1, MaxSilence: time.Hour},
+			readings: []reading{
+				{after: 0, value: 20.0, recorded: true},
+				{after: 30 * time.Minute, value: 20.2, recorded: false},
+				{after: 59 * time.Minute, value: 20.3, recorded: false},
+				{after: 60 * time.Minute, value: 20.4, recorded: true},
+				{after: 61 * time.Minute, value: 20.5, recorded: false},
+			},
+		},
+		{
+			name:      "heartbeat within deadband",
+			deadband:  monitor.Deadband{Absolute: 1},
+			heartbeat: 30 * time.Minute,
+			readings: []reading{
+				{after: 0, value: 20.0, recorded: true},
+				{after: 20 * time.Minute, value: 20.2, recorded: false},
+				{after: 30 * time.Minute, value: 20.3, recorded: true},
+				{after: 40 * time.Minute, value: 20.4, recorded: false},
+				{after: 60 * time.Minute, value: 20.5, recorded: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testObj := new(MockedSTClient)
+			clockObj := new(MockedClock)
+			recorder := new(MockedRecorder)
+			recorder.On("Add", mock.Anything).Return(nil)
+
+			mon := monitor.New(
+				monitor.SetClient(testObj),
+				monitor.SetRecorder(recorder),
+				monitor.WithClock(clockObj),
+				monitor.WithPeriod(time.Second),
+				monitor.Capabilities(monitor.MonitorCapabilities{
+					{Name: "temperatureMeasurement", Time: monitor.SensorTime, Deadband: tt.deadband, Heartbeat: tt.heartbeat},
+				}),
+			)
+
+			for i, r := range tt.readings {
+				now := start.Add(r.after)
+				setNow(clockObj, now)
+
+				testObj.ExpectedCalls = nil
+				testObj.On("Devices").Return(
+					smartthings.DevicesList{
+						Items: []smartthings.Device{
+							{
+								DeviceId: id1,
+								Label:    "Mocked Device",
+								Components: []smartthings.Component{
+									{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+								},
+							},
+						},
+					},
+					nil,
+				)
+				testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+					map[string]smartthings.CapabilityStatus{
+						"temperature": {Timestamp: now, Unit: "C", Value: r.value},
+					},
+					nil,
+				)
+
+				got := cycleRecords(t, mon, recorder)
+				if (len(got) > 0) != r.recorded {
+					t.Errorf("reading %d (%f): recorded = %v, want %v", i, r.value, len(got) > 0, r.recorded)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitor_Stale(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	clockObj := new(MockedClock)
+	recorder := new(MockedRecorder)
+	recorder.On("Add", mock.Anything).Return(nil)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.SetRecorder(recorder),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Second),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime, Stale: time.Hour},
+		}),
+	)
+
+	steps := []struct {
+		name       string
+		after      time.Duration
+		sensorTime time.Duration
+		want       []float64
+	}{
+		{name: "fresh", after: 0, sensorTime: 0, want: []float64{}},
+		{name: "within threshold", after: 30 * time.Minute, sensorTime: 0, want: []float64{}},
+		{name: "becomes stale", after: 61 * time.Minute, sensorTime: 0, want: []float64{1}},
+		{name: "still stale", after: 2 * time.Hour, sensorTime: 0, want: []float64{}},
+		{name: "fresh again", after: 3 * time.Hour, sensorTime: 3 * time.Hour, want: []float64{0}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+
+			testObj.ExpectedCalls = nil
+			testObj.On("Devices").Return(
+				smartthings.DevicesList{
+					Items: []smartthings.Device{
+						{
+							DeviceId: id1,
+							Label:    "Mocked Device",
+							Components: []smartthings.Component{
+								{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+							},
+						},
+					},
+				},
+				nil,
+			)
+			testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+				map[string]smartthings.CapabilityStatus{
+					"temperature": {Timestamp: start.Add(step.sensorTime), Unit: "C", Value: 21.0},
+				},
+				nil,
+			)
+
+			got := []float64{}
+			for _, dp := range cycleRecords(t, mon, recorder) {
+				if dp.Key == monitor.SensorStaleMeasurement {
+					if dp.Tags["attribute"] != "temperature" {
+						t.Errorf("sensorStale attribute = %s, want temperature", dp.Tags["attribute"])
+					}
+					got = append(got, dp.Value)
+				}
+			}
+
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("Monitor.Cycle() sensorStale values = %v, want %v", got, step.want)
+			}
+		})
+	}
+}
+
+func TestMonitor_InventoryCache(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Label:    "Mocked Device",
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	status := testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+		map[string]smartthings.CapabilityStatus{
+			"temperature": {Timestamp: start, Unit: "C", Value: 21.0},
+		},
+		nil,
+	)
+
+	clockObj := new(MockedClock)
+	recorder := new(MockedRecorder)
+	recorder.On("Add", mock.Anything).Return(nil)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.SetRecorder(recorder),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Minute),
+		monitor.WithInventoryRefresh(30*time.Minute),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime},
+		}),
+	)
+
+	devicesCalls := func() int {
+		n := 0
+		for _, c := range testObj.Calls {
+			if c.Method == "Devices" {
+				n++
+			}
+		}
+		return n
+	}
+
+	steps := []struct {
+		name     string
+		after    time.Duration
+		notFound bool
+		want     int
+	}{
+		{name: "first cycle fetches", after: 0, want: 1},
+		{name: "cached", after: 10 * time.Minute, want: 1},
+		{name: "refresh interval", after: 30 * time.Minute, want: 2},
+		{name: "cached after refresh", after: 31 * time.Minute, notFound: true, want: 2},
+		{name: "refreshed after not found", after: 32 * time.Minute, want: 3},
+		{name: "cached after forced refresh", after: 33 * time.Minute, want: 3},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+			if step.notFound {
+				status.Return(map[string]smartthings.CapabilityStatus{}, &smartthings.APIError{StatusCode: 404})
+			} else {
+				status.Return(map[string]smartthings.CapabilityStatus{"temperature": {Timestamp: start, Unit: "C", Value: 21.0}}, nil)
+			}
+
+			if err := mon.Cycle(); err != nil {
+				t.Fatalf("Monitor.Cycle() error = %v", err)
+			}
+
+			if got := devicesCalls(); got != step.want {
+				t.Errorf("Devices() calls = %d, want %d", got, step.want)
+			}
+		})
+	}
+
+	mon.RefreshInventory()
+	setNow(clockObj, start.Add(34*time.Minute))
+	if err := mon.Cycle(); err != nil {
+		t.Fatalf("Monitor.Cycle() error = %v", err)
+	}
+	if got := devicesCalls(); got != 4 {
+		t.Errorf("Devices() calls after RefreshInventory = %d, want 4", got)
+	}
+}
+
+func TestMonitor_Health(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	devices := testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Label:    "Mocked Device",
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	status := testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement")
+
+	clockObj := new(MockedClock)
+	recorder := new(MockedRecorder)
+	add := recorder.On("Add", mock.Anything)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.SetRecorder(recorder),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Minute),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.WallTime},
+		}),
+	)
+
+	setNow(clockObj, start)
+	if err := mon.Liveness(3); err == nil {
+		t.Errorf("Monitor.Liveness() before running expected error")
+	}
+	if err := mon.Readiness(); err == nil {
+		t.Errorf("Monitor.Readiness() before reaching SmartThings expected error")
+	}
+
+	steps := []struct {
+		name        string
+		after       time.Duration
+		devicesErr  error
+		recorderErr error
+		wantLive    bool
+		wantReady   bool
+	}{
+		{name: "healthy", after: 0, wantLive: true, wantReady: true},
+		{name: "recorder failing", after: time.Minute, recorderErr: errors.New("connection refused"), wantLive: true, wantReady: false},
+		{name: "recorder failing for too long", after: 4 * time.Minute, recorderErr: errors.New("connection refused"), wantLive: false, wantReady: false},
+		{name: "smartthings failing", after: 5 * time.Minute, devicesErr: errors.New("timeout"), wantLive: false, wantReady: false},
+		{name: "recovered", after: 6 * time.Minute, wantLive: true, wantReady: true},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+			devices.Return(devices.ReturnArguments.Get(0), step.devicesErr)
+			status.Return(map[string]smartthings.CapabilityStatus{"temperature": {Timestamp: start, Unit: "C", Value: 21.0}}, nil)
+			add.Return(step.recorderErr)
+
+			_ = mon.Cycle()
+
+			if err := mon.Liveness(3); (err == nil) != step.wantLive {
+				t.Errorf("Monitor.Liveness() = %v, want live %v", err, step.wantLive)
+			}
+			if err := mon.Readiness(); (err == nil) != step.wantReady {
+				t.Errorf("Monitor.Readiness() = %v, want ready %v", err, step.wantReady)
+			}
+		})
+	}
+}
+
+func TestMonitor_MultipleRecorders(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Label:    "Mocked Device",
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+		map[string]smartthings.CapabilityStatus{
+			"temperature": {Timestamp: start, Unit: "C", Value: 21.0},
+		},
+		nil,
+	)
+
+	clockObj := new(MockedClock)
+	healthy := new(MockedRecorder)
+	healthy.On("Add", mock.Anything).Return(nil)
+	failing := new(MockedRecorder)
+	add := failing.On("Add", mock.Anything)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.AddRecorder("healthy", healthy),
+		monitor.AddRecorder("failing", failing),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Minute),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime},
+		}),
+	)
+
+	reading := monitor.DeviceDataPoint{
+		Key:        "temperature",
+		DeviceId:   id1,
+		Device:     "Mocked Device",
+		Component:  "main",
+		Capability: "temperatureMeasurement",
+		Value:      21.0,
+		Unit:       "C",
+		Timestamp:  start,
+		SensorTime: start,
+	}
+	records := func(recorder *MockedRecorder) []monitor.DeviceDataPoint {
+		dps := []monitor.DeviceDataPoint{}
+		for _, call := range recorder.Calls {
+			for _, dp := range call.Arguments.Get(0).([]monitor.DeviceDataPoint) {
+				if dp.Key == reading.Key {
+					dps = append(dps, dp)
+				}
+			}
+		}
+		return dps
+	}
+
+	steps := []struct {
+		name        string
+		after       time.Duration
+		recorderErr error
+		wantErr     bool
+		wantHealthy int
+		wantFailing int
+	}{
+		{name: "one recorder failing", after: 0, recorderErr: errors.New("connection refused"), wantErr: true, wantHealthy: 1, wantFailing: 1},
+		{name: "failing recorder retries unchanged reading", after: time.Minute, wantHealthy: 1, wantFailing: 2},
+		{name: "both recorders up to date", after: 2 * time.Minute, wantHealthy: 1, wantFailing: 2},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			setNow(clockObj, start.Add(step.after))
+			add.Return(step.recorderErr)
+
+			err := mon.Cycle()
+			if (err != nil) != step.wantErr {
+				t.Errorf("Monitor.Cycle() error = %v, wantErr %v", err, step.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "failing: connection refused") {
+				t.Errorf("Monitor.Cycle() error = %v, want it to name the failing recorder", err)
+			}
+			if got := records(healthy); len(got) != step.wantHealthy || !reflect.DeepEqual(got[0], reading) {
+				t.Errorf("healthy recorder got %v, want %d readings", got, step.wantHealthy)
+			}
+			if got := records(failing); len(got) != step.wantFailing {
+				t.Errorf("failing recorder got %v, want %d readings", got, step.wantFailing)
+			}
+		})
+	}
+}
+
+// blockingRecorder is a recorder whose writes wait for release.
+type blockingRecorder struct {
+	MockedRecorder
+	release chan struct{}
+}
+
+func (r *blockingRecorder) Add(dps []monitor.DeviceDataPoint) error {
+	<-r.release
+	return r.MockedRecorder.Add(dps)
+}
+
+func TestMonitor_SlowRecorder(t *testing.T) {
+	id1 := uuid.New()
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	testObj := new(MockedSTClient)
+	testObj.On("Devices").Return(
+		smartthings.DevicesList{
+			Items: []smartthings.Device{
+				{
+					DeviceId: id1,
+					Label:    "Mocked Device",
+					Components: []smartthings.Component{
+						{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+		map[string]smartthings.CapabilityStatus{
+			"temperature": {Timestamp: start, Unit: "C", Value: 21.0},
+		},
+		nil,
+	)
+
+	clockObj := new(MockedClock)
+	fast := new(MockedRecorder)
+	fast.On("Add", mock.Anything).Return(nil)
+	slow := &blockingRecorder{release: make(chan struct{})}
+	slow.On("Add", mock.Anything).Return(nil)
+
+	mon := monitor.New(
+		monitor.SetClient(testObj),
+		monitor.AddRecorder("slow", slow),
+		monitor.AddRecorder("fast", fast),
+		monitor.WithClock(clockObj),
+		monitor.WithPeriod(time.Minute),
+		monitor.WithWriteTimeout(50*time.Millisecond),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "temperatureMeasurement", Time: monitor.SensorTime},
+		}),
+	)
+
+	setNow(clockObj, start)
+	began := time.Now()
+	err := mon.Cycle()
+	if err == nil || !strings.Contains(err.Error(), "slow: write not done") {
+		t.Errorf("Monitor.Cycle() error = %v, want slow: write not done", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("Monitor.Cycle() took %s, want the slow recorder to time out", elapsed)
+	}
+	fast.AssertNumberOfCalls(t, "Add", 1)
+
+	setNow(clockObj, start.Add(time.Minute))
+	err = mon.Cycle()
+	if err == nil || !strings.Contains(err.Error(), "slow: previous write still running") {
+		t.Errorf("Monitor.Cycle() error = %v, want slow: previous write still running", err)
+	}
+
+	// The write finishing late is committed, the reading is not written again
+	close(slow.release)
+	for after := 2 * time.Minute; mon.Cycle() != nil; after += time.Minute {
+		if after > time.Hour {
+			t.Fatalf("slow recorder write never finished")
+		}
+		setNow(clockObj, start.Add(after))
+		time.Sleep(time.Millisecond)
+	}
+	slow.AssertNumberOfCalls(t, "Add", 1)
+	fast.AssertNumberOfCalls(t, "Add", 1)
+}
+
+func TestMultiRecorder_Add(t *testing.T) {
+	dps := []monitor.DeviceDataPoint{{Key: "temperature", Value: 21}}
+
+	first := new(MockedRecorder)
+	first.On("Add", dps).Return(errors.New("timeout")).Once()
+	second := new(MockedRecorder)
+	second.On("Add", dps).Return(nil).Once()
+
+	recorders := monitor.MultiRecorder{{Name: "first", Recorder: first}, {Name: "second", Recorder: second}}
+	err := recorders.Add(dps)
+	if err == nil || err.Error() != "first: timeout" {
+		t.Errorf("MultiRecorder.Add() error = %v, want first: timeout", err)
+	}
+
+	first.AssertExpectations(t)
+	second.AssertExpectations(t)
+}
+
+// lifecycleRecorder is a recorder keeping the lifecycle calls.
+type lifecycleRecorder struct {
+	MockedRecorder
+	calls   []string
+	openErr error
+	// openErrs are returned by the first opens, openErr by the next ones
+	openErrs []error
+}
+
+func (r *lifecycleRecorder) Open() error {
+	r.calls = append(r.calls, "open")
+	if len(r.openErrs) > 0 {
+		err := r.openErrs[0]
+		r.openErrs = r.openErrs[1:]
+		return err
+	}
+	return r.openErr
+}
+
+func (r *lifecycleRecorder) Flush() error {
+	r.calls = append(r.calls, "flush")
+	return nil
+}
+
+func (r *lifecycleRecorder) Close() error {
+	r.calls = append(r.calls, "close")
+	return nil
+}
+
+func TestMonitor_RunContext(t *testing.T) {
+	t.Run("stopped", func(t *testing.T) {
+		recorder := &lifecycleRecorder{}
+		mon := monitor.New(monitor.SetRecorder(recorder))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := mon.RunContext(ctx); err != nil {
+			t.Errorf("Monitor.RunContext() error = %v", err)
+		}
+		if want := []string{"open", "flush", "close"}; !reflect.DeepEqual(recorder.calls, want) {
+			t.Errorf("recorder calls = %v, want %v", recorder.calls, want)
+		}
+	})
+
+	t.Run("open fails", func(t *testing.T) {
+		// The recorder can't be reached, the monitor keeps running and it is
+		// opened again before writing
+		recorder := &lifecycleRecorder{openErr: errors.New("connection refused")}
+		mon := monitor.New(monitor.AddRecorder("influxdbv2", recorder))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := mon.RunContext(ctx); err != nil {
+			t.Errorf("Monitor.RunContext() error = %v", err)
+		}
+		if want := []string{"open", "flush", "close"}; !reflect.DeepEqual(recorder.calls, want) {
+			t.Errorf("recorder calls = %v, want %v", recorder.calls, want)
+		}
+	})
+
+	t.Run("wrong settings", func(t *testing.T) {
+		// Retrying does not fix the settings, the monitor stops
+		recorder := &lifecycleRecorder{openErr: &monitor.ConfigError{Err: errors.New("influx bucket not found")}}
+		mon := monitor.New(monitor.AddRecorder("influxdbv2", recorder))
+
+		err := mon.RunContext(context.Background())
+		if !monitor.IsConfigError(err) || !strings.Contains(err.Error(), "influxdbv2: influx bucket not found") {
+			t.Errorf("Monitor.RunContext() error = %v, want influxdbv2: influx bucket not found", err)
+		}
+		if want := []string{"open", "flush", "close"}; !reflect.DeepEqual(recorder.calls, want) {
+			t.Errorf("recorder calls = %v, want %v", recorder.calls, want)
+		}
+	})
+
+	t.Run("wrong settings once reached", func(t *testing.T) {
+		id1 := uuid.New()
+		testObj := new(MockedSTClient)
+		testObj.On("Devices").Return(
+			smartthings.DevicesList{
+				Items: []smartthings.Device{
+					{
+						DeviceId: id1,
+						Label:    "Mocked Device",
+						Components: []smartthings.Component{
+							{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+						},
+					},
+				},
+			},
+			nil,
+		)
+		testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+			map[string]smartthings.CapabilityStatus{
+				"temperature": {Timestamp: time.Now(), Unit: "C", Value: 21.0},
+			},
+			nil,
+		)
+
+		recorder := &lifecycleRecorder{
+			openErrs: []error{errors.New("connection refused")},
+			openErr:  &monitor.ConfigError{Err: errors.New("influx bucket not found")},
+		}
+		mon := monitor.New(
+			monitor.SetClient(testObj),
+			monitor.AddRecorder("influxdbv2", recorder),
+			monitor.Capabilities(monitor.MonitorCapabilities{{Name: "temperatureMeasurement"}}),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := mon.RunContext(ctx)
+		if !monitor.IsConfigError(err) {
+			t.Errorf("Monitor.RunContext() error = %v, want influx bucket not found", err)
+		}
+		recorder.AssertNumberOfCalls(t, "Add", 0)
+		if want := []string{"open", "open", "flush", "close"}; !reflect.DeepEqual(recorder.calls, want) {
+			t.Errorf("recorder calls = %v, want %v", recorder.calls, want)
+		}
+	})
+
+	t.Run("opened before writing", func(t *testing.T) {
+		id1 := uuid.New()
+		testObj := new(MockedSTClient)
+		testObj.On("Devices").Return(
+			smartthings.DevicesList{
+				Items: []smartthings.Device{
+					{
+						DeviceId: id1,
+						Label:    "Mocked Device",
+						Components: []smartthings.Component{
+							{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+						},
+					},
+				},
+			},
+			nil,
+		)
+		testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+			map[string]smartthings.CapabilityStatus{
+				"temperature": {Timestamp: time.Now(), Unit: "C", Value: 21.0},
+			},
+			nil,
+		)
+
+		clockObj := new(MockedClock)
+		setNow(clockObj, time.Now())
+		recorder := &lifecycleRecorder{openErr: errors.New("connection refused")}
+		recorder.On("Add", mock.Anything).Return(nil)
+		mon := monitor.New(
+			monitor.SetClient(testObj),
+			monitor.AddRecorder("influxdbv2", recorder),
+			monitor.WithClock(clockObj),
+			monitor.WithPeriod(time.Minute),
+			monitor.Capabilities(monitor.MonitorCapabilities{{Name: "temperatureMeasurement"}}),
+		)
+
+		err := mon.Cycle()
+		if err == nil || !strings.Contains(err.Error(), "influxdbv2: could not open: connection refused") {
+			t.Errorf("Monitor.Cycle() error = %v, want influxdbv2: could not open: connection refused", err)
+		}
+		recorder.AssertNumberOfCalls(t, "Add", 0)
+
+		recorder.openErr = nil
+		setNow(clockObj, time.Now().Add(time.Minute))
+		if err := mon.Cycle(); err != nil {
+			t.Errorf("Monitor.Cycle() error = %v", err)
+		}
+		recorder.AssertNumberOfCalls(t, "Add", 1)
+		if want := []string{"open", "open"}; !reflect.DeepEqual(recorder.calls, want) {
+			t.Errorf("recorder calls = %v, want %v", recorder.calls, want)
+		}
+	})
+
+	t.Run("stopped while writing", func(t *testing.T) {
+		id1 := uuid.New()
+		testObj := new(MockedSTClient)
+		testObj.On("Devices").Return(
+			smartthings.DevicesList{
+				Items: []smartthings.Device{
+					{
+						DeviceId: id1,
+						Label:    "Mocked Device",
+						Components: []smartthings.Component{
+							{Id: "main", Capabilities: []smartthings.Capability{{Id: "temperatureMeasurement", Version: 1}}},
+						},
+					},
+				},
+			},
+			nil,
+		)
+		testObj.On("DeviceCapabilityStatus", id1, "main", "temperatureMeasurement").Return(
+			map[string]smartthings.CapabilityStatus{
+				"temperature": {Timestamp: time.Now(), Unit: "C", Value: 21.0},
+			},
+			nil,
+		)
+
+		slow := &blockingRecorder{release: make(chan struct{})}
+		defer close(slow.release)
+		slow.On("Add", mock.Anything).Return(nil)
+		mon := monitor.New(
+			monitor.SetClient(testObj),
+			monitor.SetRecorder(slow),
+			monitor.WithWriteTimeout(time.Hour),
+			monitor.Capabilities(monitor.MonitorCapabilities{{Name: "temperatureMeasurement"}}),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		done := make(chan error)
+		go func() { done <- mon.RunContext(ctx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Monitor.RunContext() error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Monitor.RunContext() did not stop while the recorder was writing")
+		}
+	})
+}
+
+func TestMonitor_Import(t *testing.T) {
+	id := uuid.New()
+	other := uuid.New()
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	point := func(device uuid.UUID, capability, key string, value float64, after time.Duration) monitor.DeviceDataPoint {
+		label := "Mocked Device"
+		if device == other {
+			label = "Test Device"
+		}
+		return monitor.DeviceDataPoint{Key: key, DeviceId: device, Device: label, Component: "main", Capability: capability, Value: value, Timestamp: ts.Add(after), SensorTime: ts.Add(after)}
+	}
+	archived := []monitor.DeviceDataPoint{
+		point(id, "powerMeter", "power", 1, 0),
+		point(id, "powerMeter", "powerConsumption", 1, 0),
+		point(id, "powerMeter", monitor.SensorStaleMeasurement, 1, 0),
+		point(id, "temperatureMeasurement", "temperature", 1, 0),
+		// Same reading time, skipped by the dedup of the device
+		point(id, "powerMeter", "power", 3, 0),
+		// Within the deadband
+		point(id, "powerMeter", "power", 1.5, time.Minute),
+		point(id, "powerMeter", "power", 5, 2*time.Minute),
+		// Excluded device
+		point(other, "powerMeter", "power", 1, 0),
+	}
+	want := []monitor.DeviceDataPoint{archived[0], archived[2], archived[6]}
+
+	client := new(MockedSTClient)
+	client.On("Devices").Return(
+		smartthings.DevicesList{Items: []smartthings.Device{{DeviceId: other, Label: "Test Device", Name: "Test"}}},
+		nil,
+	).Once()
+	database := new(MockedRecorder)
+	database.On("Add", want).Return(nil).Twice()
+	archive := new(MockedRecorder)
+	archive.On("Add", want).Return(nil).Once()
+
+	dedup, noDedup := true, false
+	mon := monitor.New(
+		monitor.SetClient(client),
+		monitor.AddRecorder("database", database),
+		monitor.AddRecorder("archive", archive),
+		monitor.Capabilities(monitor.MonitorCapabilities{
+			{Name: "powerMeter", ExcludeAttributes: []string{"powerConsumption"}, Dedup: &noDedup, Deadband: monitor.Deadband{Absolute: 1}},
+		}),
+		monitor.WithDeviceFilters(monitor.DeviceFilters{Exclude: monitor.DeviceFilter{Names: []string{"Test"}}}),
+		monitor.WithDeviceOverrides(monitor.DeviceOverrides{
+			"Mocked Device": {CapabilityOverride: monitor.CapabilityOverride{Dedup: &dedup}},
+		}),
+	)
+
+	n, err := mon.Import(archived, true)
+	if err != nil || n != 3 {
+		t.Errorf("Monitor.Import() dry run = %d, %v, want 3, nil", n, err)
+	}
+
+	n, err = mon.Import(archived, false)
+	if err != nil || n != 3 {
+		t.Errorf("Monitor.Import() = %d, %v, want 3, nil", n, err)
+	}
+
+	// Recorders imported separately get the same points
+	n, err = mon.Import(archived, false, "database")
+	if err != nil || n != 3 {
+		t.Errorf("Monitor.Import() to database = %d, %v, want 3, nil", n, err)
+	}
+
+	if _, err := mon.Import(archived, false, "missing"); err == nil {
+		t.Errorf("Monitor.Import() to a missing recorder should fail")
+	}
+
+	client.AssertExpectations(t)
+	database.AssertExpectations(t)
+	archive.AssertExpectations(t)
+}
+
+func TestMonitor_Import_AllCapabilities(t *testing.T) {
+	id := uuid.New()
+	ts, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	archived := []monitor.DeviceDataPoint{
+		{Key: "power", DeviceId: id, Device: "Mocked Device", Component: "main", Capability: "powerMeter", Value: 1, Timestamp: ts},
+		{Key: "temperature", DeviceId: id, Device: "Mocked Device", Component: "main", Capability: "temperatureMeasurement", Value: 20, Timestamp: ts},
+		// Same reading time, skipped by the default dedup
+		{Key: "temperature", DeviceId: id, Device: "Mocked Device", Component: "main", Capability: "temperatureMeasurement", Value: 21, Timestamp: ts},
+	}
+
+	// With no capability monitored all of them are imported
+	database := new(MockedRecorder)
+	database.On("Add", archived[:2]).Return(nil).Once()
+	mon := monitor.New(monitor.AddRecorder("database", database))
+
+	n, err := mon.Import(archived, false)
+	if err != nil || n != 2 {
+		t.Errorf("Monitor.Import() = %d, %v, want 2, nil", n, err)
+	}
+	database.AssertExpectations(t)
+}
@@ -14,9 +14,19 @@ func WithClock(clock Clock) MonitorOption {
 	}
 }
 
+// SetRecorder sets the recorder replacing any other
 func SetRecorder(recorder Recorder) MonitorOption {
 	return func(m *Monitor) {
-		m.recorder = recorder
+		m.sinks = []*sink{newSink("database", recorder)}
+	}
+}
+
+// AddRecorder adds a recorder to the ones written. Each keeps its own
+// record of what was written to it, so a failing recorder gets the points
+// it missed once it recovers without affecting the others.
+func AddRecorder(name string, recorder Recorder) MonitorOption {
+	return func(m *Monitor) {
+		m.sinks = append(m.sinks, newSink(name, recorder))
 	}
 }
 
@@ -43,6 +53,38 @@ func Capabilities(capabilities MonitorCapabilities) MonitorOption {
 	}
 }
 
+// WithDeviceFilters sets which devices are monitored
+func WithDeviceFilters(filters DeviceFilters) MonitorOption {
+	return func(m *Monitor) {
+		m.filters = filters
+	}
+}
+
+// WithDeviceOverrides sets per device settings replacing the
+// capability ones
+func WithDeviceOverrides(overrides DeviceOverrides) MonitorOption {
+	return func(m *Monitor) {
+		m.overrides = overrides
+	}
+}
+
+// WithInventoryRefresh caches the SmartThings device list between cycles
+// fetching it again after refresh. When zero it is fetched every cycle.
+func WithInventoryRefresh(refresh time.Duration) MonitorOption {
+	return func(m *Monitor) {
+		m.inventoryRefresh = refresh
+	}
+}
+
+// WithWriteTimeout bounds how long the monitor waits for each recorder to
+// be written. A recorder still writing when it expires is skipped until
+// the write finishes.
+func WithWriteTimeout(timeout time.Duration) MonitorOption {
+	return func(m *Monitor) {
+		m.writeTimeout = timeout
+	}
+}
+
 func WithConversion(cmap ConversionMap) MonitorOption {
 	return func(m *Monitor) {
 		m.converter = cmap
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CapabilityOverride replaces capability settings for a device. Empty
+// values keep the setting inherited from the capability configuration.
+type CapabilityOverride struct {
+	Time      ReadTime
+	Dedup     *bool
+	ValueMap  ConversionMap
+	Heartbeat time.Duration
+	Deadband  Deadband
+	Stale     time.Duration
+}
+
+// DeviceOverride replaces capability settings for all capabilities of a
+// device and, through Capabilities, for specific capabilities of it.
+type DeviceOverride struct {
+	CapabilityOverride `mapstructure:",squash"`
+	Capabilities       map[string]CapabilityOverride
+}
+
+// DeviceOverrides are device overrides keyed by device ID or label.
+type DeviceOverrides map[string]DeviceOverride
+
+// DeviceOverrideKey is the field naming the device of an override when
+// overrides are configured as a list, so labels are kept as they are.
+const DeviceOverrideKey = "device"
+
+// captureSettings are the effective settings used to read a capability
+// of a device.
+type captureSettings struct {
+	Time      ReadTime
+	Dedup     bool
+	Heartbeat time.Duration
+	Deadband  Deadband
+	Stale     time.Duration
+	Converter ConversionMap
+}
+
+// settings resolves the settings for a capability of a device. Precedence
+// from lowest to highest is: monitor defaults, capability configuration,
+// device override by label, device override by ID, and capability
+// overrides within the device override in that same order.
+func (mon Monitor) settings(deviceId uuid.UUID, label string, capability string) captureSettings {
+	s := captureSettings{Time: SensorTime, Dedup: true, Converter: mon.converter}
+
+	if mc, ok := mon.capabilities[capability]; ok {
+		if mc.Time != "" {
+			s.Time = mc.Time
+		}
+		if mc.Dedup != nil {
+			s.Dedup = *mc.Dedup
+		}
+		s.Heartbeat = mc.Heartbeat
+		s.Deadband = mc.Deadband
+		s.Stale = mc.Stale
+	}
+
+	overrides := mon.overrides.lookup(deviceId, label)
+	for _, o := range overrides {
+		s.apply(o.CapabilityOverride)
+	}
+
+	for _, o := range overrides {
+		for name, co := range o.Capabilities {
+			if strings.EqualFold(name, capability) {
+				s.apply(co)
+			}
+		}
+	}
+
+	return s
+}
+
+func (s *captureSettings) apply(o CapabilityOverride) {
+	if o.Time != "" {
+		s.Time = o.Time
+	}
+
+	if o.Dedup != nil {
+		s.Dedup = *o.Dedup
+	}
+
+	if len(o.ValueMap) > 0 {
+		s.Converter = s.Converter.Merge(o.ValueMap)
+	}
+
+	if o.Heartbeat > 0 {
+		s.Heartbeat = o.Heartbeat
+	}
+
+	if !o.Deadband.IsEmpty() {
+		s.Deadband = o.Deadband
+	}
+
+	if o.Stale > 0 {
+		s.Stale = o.Stale
+	}
+}
+
+// lookup returns the overrides that apply to the device, the one keyed
+// by label first and the one keyed by ID last. Keys are compared
+// ignoring case as configuration files may not keep it.
+func (d DeviceOverrides) lookup(deviceId uuid.UUID, label string) []DeviceOverride {
+	result := []DeviceOverride{}
+
+	for key, o := range d {
+		if label != "" && strings.EqualFold(key, label) {
+			result = append(result, o)
+		}
+	}
+
+	for key, o := range d {
+		if strings.EqualFold(key, deviceId.String()) {
+			result = append(result, o)
+		}
+	}
+
+	return result
+}
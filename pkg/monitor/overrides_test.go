@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMonitor_settings(t *testing.T) {
+	id := uuid.MustParse("27118afd-2f98-425c-8211-899eb596edad")
+	dedupOff := false
+	dedupOn := true
+	global := ConversionMap{"switch": {"on": 1, "off": 0}}
+
+	tests := []struct {
+		name       string
+		opts       []MonitorOption
+		capability string
+		want       captureSettings
+	}{
+		{
+			name:       "defaults",
+			opts:       []MonitorOption{WithConversion(global)},
+			capability: "switch",
+			want:       captureSettings{Time: SensorTime, Dedup: true, Converter: global},
+		},
+		{
+			name: "capability",
+			opts: []MonitorOption{
+				WithConversion(global),
+				Capabilities(MonitorCapabilities{{Name: "switch", Time: WallTime, Dedup: &dedupOff}}),
+			},
+			capability: "switch",
+			want:       captureSettings{Time: WallTime, Dedup: false, Converter: global},
+		},
+		{
+			name: "device by label over capability",
+			opts: []MonitorOption{
+				WithConversion(global),
+				Capabilities(MonitorCapabilities{{Name: "switch", Time: WallTime, Dedup: &dedupOff}}),
+				WithDeviceOverrides(DeviceOverrides{
+					"garbage disposal": {CapabilityOverride: CapabilityOverride{Time: SensorTime, ValueMap: ConversionMap{"Switch": {"on": 100}}}},
+				}),
+			},
+			capability: "switch",
+			want:       captureSettings{Time: SensorTime, Dedup: false, Converter: ConversionMap{"switch": {"on": 100, "off": 0}}},
+		},
+		{
+			name: "device by id over device by label",
+			opts: []MonitorOption{
+				WithConversion(global),
+				WithDeviceOverrides(DeviceOverrides{
+					"Garbage Disposal":                     {CapabilityOverride: CapabilityOverride{Time: WallTime, Dedup: &dedupOff}},
+					"27118AFD-2F98-425C-8211-899EB596EDAD": {CapabilityOverride: CapabilityOverride{Time: SensorTime}},
+				}),
+			},
+			capability: "switch",
+			want:       captureSettings{Time: SensorTime, Dedup: false, Converter: global},
+		},
+		{
+			name: "device capability over device",
+			opts: []MonitorOption{
+				WithConversion(global),
+				WithDeviceOverrides(DeviceOverrides{
+					"27118afd-2f98-425c-8211-899eb596edad": {
+						CapabilityOverride: CapabilityOverride{Time: WallTime, Dedup: &dedupOff},
+						Capabilities: map[string]CapabilityOverride{
+							"switch": {Dedup: &dedupOn},
+						},
+					},
+				}),
+			},
+			capability: "switch",
+			want:       captureSettings{Time: WallTime, Dedup: true, Converter: global},
+		},
+		{
+			name: "device capability override of another capability",
+			opts: []MonitorOption{
+				WithConversion(global),
+				WithDeviceOverrides(DeviceOverrides{
+					"garbage disposal": {Capabilities: map[string]CapabilityOverride{"switchlevel": {Time: WallTime}}},
+				}),
+			},
+			capability: "switch",
+			want:       captureSettings{Time: SensorTime, Dedup: true, Converter: global},
+		},
+		{
+			name: "device heartbeat deadband and stale over capability",
+			opts: []MonitorOption{
+				WithConversion(global),
+				Capabilities(MonitorCapabilities{{Name: "switch", Heartbeat: time.Hour, Deadband: Deadband{Percent: 5}, Stale: time.Hour}}),
+				WithDeviceOverrides(DeviceOverrides{
+					"garbage disposal": {
+						CapabilityOverride: CapabilityOverride{Heartbeat: 10 * time.Minute, Stale: 2 * time.Hour},
+						Capabilities: map[string]CapabilityOverride{
+							"switch": {Deadband: Deadband{Absolute: 1}},
+						},
+					},
+				}),
+			},
+			capability: "switch",
+			want: captureSettings{Time: SensorTime, Dedup: true, Converter: global,
+				Heartbeat: 10 * time.Minute, Deadband: Deadband{Absolute: 1}, Stale: 2 * time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mon := New(tt.opts...)
+			if got := mon.settings(id, "Garbage Disposal", tt.capability); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Monitor.settings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
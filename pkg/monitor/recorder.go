@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,6 +12,75 @@ type Recorder interface {
 	Add([]DeviceDataPoint) error
 }
 
+// Opener is a recorder that connects to or sets up its database before
+// recording. Open is called once before the first Add and fails when the
+// database can't be written.
+type Opener interface {
+	Open() error
+}
+
+// Flusher is a recorder that buffers writes. Flush writes what is
+// buffered.
+type Flusher interface {
+	Flush() error
+}
+
+// Closer is a recorder holding resources. Close releases them, the
+// recorder is not used after closing.
+type Closer interface {
+	Close() error
+}
+
+// ConfigError is returned by Open when the database settings are wrong,
+// such as a missing bucket or a rejected token. Retrying does not fix it
+// so the monitor stops on it, other Open errors are retried.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// IsConfigError tells if the error is, or wraps, a ConfigError.
+func IsConfigError(err error) bool {
+	var cerr *ConfigError
+
+	return errors.As(err, &cerr)
+}
+
+// Open opens the recorder if it is an Opener.
+func Open(r Recorder) error {
+	if o, ok := r.(Opener); ok {
+		return o.Open()
+	}
+
+	return nil
+}
+
+// Flush flushes the recorder if it is a Flusher.
+func Flush(r Recorder) error {
+	if f, ok := r.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// Close flushes and closes the recorder if it is a Closer.
+func Close(r Recorder) error {
+	err := Flush(r)
+	if c, ok := r.(Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+
+	return err
+}
+
 type DeviceDataPoint struct {
 	Key        string
 	DeviceId   uuid.UUID
@@ -20,13 +90,33 @@ type DeviceDataPoint struct {
 	Unit       string
 	Value      float64
 	Timestamp  time.Time
+	// SensorTime is the time the sensor made the reading, Timestamp may
+	// differ from it depending on the capability read time
+	SensorTime time.Time
+	// Tags are additional tags identifying the series
+	Tags map[string]string
+	// Heartbeat flags an unchanged reading recorded again at wall time
+	Heartbeat bool
+	// PolledAt is the wall time the reading was polled. Only set when the
+	// capability records both times.
+	PolledAt time.Time
+	// Age is how old the reading was when polled. Only set when the
+	// capability records both times.
+	Age time.Duration
+	// Room is the name of the room the device is in, if any
+	Room string
+}
+
+// series identifies the time series of the data point.
+func (dp DeviceDataPoint) series() string {
+	return dp.DeviceId.String() + "/" + dp.Component + "/" + dp.Capability + "/" + dp.Key
 }
 
 type StdOutRecorder struct{}
 
 func (s *StdOutRecorder) Add(out []DeviceDataPoint) error {
 	for i, dp := range out {
-		fmt.Printf("%d, %s, %s, %s, %s, %s, %s, %f, %s\n",
+		fmt.Printf("%d, %s, %s, %s, %s, %s, %s, %f, %s, %t, %s, %v\n",
 			i,
 			dp.Timestamp,
 			dp.Key,
@@ -36,7 +126,11 @@ func (s *StdOutRecorder) Add(out []DeviceDataPoint) error {
 			dp.Capability,
 			dp.Value,
 			dp.Unit,
+			dp.Heartbeat,
+			dp.Age,
+			dp.Tags,
 		)
 	}
+
 	return nil
 }
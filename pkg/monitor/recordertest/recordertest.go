@@ -0,0 +1,108 @@
+// Package recordertest checks recorders follow the monitor.Recorder
+// contract. Every recorder implementation runs the suite against a
+// stand-in or test database:
+//
+//	func TestMyRecorder_Conformance(t *testing.T) {
+//		recordertest.Run(t, recordertest.Harness{
+//			New: func(t *testing.T) monitor.Recorder { ... },
+//		})
+//	}
+package recordertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Harness creates recorders for the suite.
+type Harness struct {
+	// New returns a recorder writing to a new, empty, test database
+	New func(t *testing.T) monitor.Recorder
+	// Written returns how many points the database of the last recorder
+	// created got. It is polled, so it must not fail the test. Nil skips
+	// checking the points reached the database.
+	Written func(t *testing.T) int
+}
+
+// Points returns data points covering what the monitor records: readings
+// with and without unit, room and tags, heartbeats, readings with both
+// times and staleness and inventory events.
+func Points() []monitor.DeviceDataPoint {
+	id := uuid.MustParse("6f1c3f4e-2b8a-4d53-9a55-0e0c5c7b9d21")
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	polled := ts.Add(5 * time.Minute)
+
+	return []monitor.DeviceDataPoint{
+		{Key: "temperature", DeviceId: id, Device: "Kitchen Sensor", Room: "Kitchen", Component: "main", Capability: "temperatureMeasurement", Unit: "C", Value: 21.5, Timestamp: ts, SensorTime: ts},
+		{Key: "switch", DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "switch", Value: 1, Timestamp: polled, SensorTime: ts, Heartbeat: true},
+		{Key: "humidity", DeviceId: id, Device: "Kitchen Sensor", Room: "Kitchen", Component: "main", Capability: "relativeHumidityMeasurement", Unit: "%", Value: 48, Timestamp: ts, SensorTime: ts, PolledAt: polled, Age: 5 * time.Minute},
+		{Key: "energy", DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "energyMeter", Unit: "kWh", Value: 2.25, Timestamp: ts, SensorTime: ts, Tags: map[string]string{"tariff": "peak"}},
+		{Key: monitor.SensorStaleMeasurement, DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "temperatureMeasurement", Value: 1, Timestamp: polled, Tags: map[string]string{"attribute": "temperature"}},
+		{Key: monitor.InventoryChangeMeasurement, DeviceId: id, Device: "Kitchen Sensor", Component: "main", Capability: "switch", Value: 1, Timestamp: polled, Tags: map[string]string{"event": monitor.DeviceAdded}},
+	}
+}
+
+// Run runs the conformance suite. Open, Flush and Close are checked when
+// the recorder implements them.
+func Run(t *testing.T, h Harness) {
+	t.Helper()
+
+	t.Run("lifecycle", func(t *testing.T) {
+		r := h.New(t)
+		require.NoError(t, monitor.Open(r), "Open")
+		require.NoError(t, r.Add(Points()), "Add")
+		require.NoError(t, monitor.Flush(r), "Flush")
+		assertWritten(t, h, len(Points()))
+		require.NoError(t, monitor.Close(r), "Close")
+	})
+
+	t.Run("add without open", func(t *testing.T) {
+		// Recorders used before the lifecycle existed are never opened
+		r := h.New(t)
+		require.NoError(t, r.Add(Points()), "Add")
+		assertWritten(t, h, len(Points()))
+		require.NoError(t, monitor.Close(r), "Close")
+	})
+
+	t.Run("add in batches", func(t *testing.T) {
+		r := h.New(t)
+		require.NoError(t, monitor.Open(r), "Open")
+		points := Points()
+		require.NoError(t, r.Add(points[:2]), "Add")
+		require.NoError(t, r.Add(points[2:]), "Add")
+		assertWritten(t, h, len(points))
+		require.NoError(t, monitor.Close(r), "Close")
+	})
+
+	t.Run("add nothing", func(t *testing.T) {
+		r := h.New(t)
+		require.NoError(t, monitor.Open(r), "Open")
+		require.NoError(t, r.Add(nil), "Add")
+		require.NoError(t, r.Add([]monitor.DeviceDataPoint{}), "Add")
+		require.NoError(t, monitor.Close(r), "Close")
+	})
+
+	t.Run("close without open", func(t *testing.T) {
+		// Commands not recording close the recorders they instantiate
+		r := h.New(t)
+		require.NoError(t, monitor.Close(r), "Close")
+	})
+}
+
+// assertWritten waits for the database to get the points, some recorders
+// publish asynchronously.
+func assertWritten(t *testing.T, h Harness, want int) {
+	t.Helper()
+
+	if h.Written == nil {
+		return
+	}
+
+	assert.Eventually(t, func() bool { return h.Written(t) >= want }, 5*time.Second, 10*time.Millisecond,
+		"database did not get the %d points", want)
+}
@@ -0,0 +1,25 @@
+package recordertest_test
+
+import (
+	"testing"
+
+	"github.com/eargollo/smartthings-influx/pkg/monitor"
+	"github.com/eargollo/smartthings-influx/pkg/monitor/recordertest"
+)
+
+func TestStdOutRecorder_Conformance(t *testing.T) {
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder { return &monitor.StdOutRecorder{} },
+	})
+}
+
+func TestMultiRecorder_Conformance(t *testing.T) {
+	recordertest.Run(t, recordertest.Harness{
+		New: func(t *testing.T) monitor.Recorder {
+			return monitor.MultiRecorder{
+				{Name: "first", Recorder: &monitor.StdOutRecorder{}},
+				{Name: "second", Recorder: &monitor.StdOutRecorder{}},
+			}
+		},
+	})
+}
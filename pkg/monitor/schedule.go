@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// minimumSleep keeps the monitor loop from spinning when items are
+// overdue.
+const minimumSleep = time.Second
+
+func scheduleKey(deviceId uuid.UUID, component string, capability string) string {
+	return deviceId.String() + "/" + component + "/" + capability
+}
+
+// interval is the polling interval of the capability. Capabilities
+// without an interval are polled at every monitor period.
+func (mon Monitor) interval(capability string) time.Duration {
+	if mc, ok := mon.capabilities[capability]; ok && mc.Interval > 0 {
+		return mc.Interval
+	}
+
+	return mon.period
+}
+
+// due tells if the capability of the device must be polled at now.
+func (mon Monitor) due(dev deviceWithCapability, now time.Time) bool {
+	next, ok := mon.nextDue[scheduleKey(dev.DeviceId, dev.ComponentId, dev.CapabilityId)]
+
+	return !ok || !now.Before(next)
+}
+
+// schedule sets the next poll of the capability of the device polled at now.
+func (mon Monitor) schedule(dev deviceWithCapability, now time.Time) {
+	mon.nextDue[scheduleKey(dev.DeviceId, dev.ComponentId, dev.CapabilityId)] = now.Add(mon.interval(dev.CapabilityId))
+}
+
+// retry sets the next poll of the capability of the device that failed
+// to be polled at now. It is polled again at the next monitor period
+// whatever its interval.
+func (mon Monitor) retry(dev deviceWithCapability, now time.Time) {
+	wait := mon.interval(dev.CapabilityId)
+	if mon.period < wait {
+		wait = mon.period
+	}
+
+	mon.nextDue[scheduleKey(dev.DeviceId, dev.ComponentId, dev.CapabilityId)] = now.Add(wait)
+}
+
+// unschedule forgets the polls of capabilities no longer monitored, of
+// devices removed or filtered out.
+func (mon Monitor) unschedule(devices []deviceWithCapability) {
+	monitored := make(map[string]bool, len(devices))
+	for _, dev := range devices {
+		monitored[scheduleKey(dev.DeviceId, dev.ComponentId, dev.CapabilityId)] = true
+	}
+
+	for key := range mon.nextDue {
+		if !monitored[key] {
+			delete(mon.nextDue, key)
+		}
+	}
+}
+
+// NextDue returns when the capability that produced the data point is
+// going to be polled again.
+func (mon Monitor) NextDue(dp DeviceDataPoint) time.Time {
+	return mon.nextDue[scheduleKey(dp.DeviceId, dp.Component, dp.Capability)]
+}
+
+// untilNextDue returns how long to wait for the next item to be due. It
+// never waits more than the monitor period so new devices are picked up.
+func (mon Monitor) untilNextDue() time.Duration {
+	now := mon.clock.Now()
+	wait := mon.period
+
+	for _, next := range mon.nextDue {
+		if next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+	}
+
+	if wait < minimumSleep {
+		wait = minimumSleep
+	}
+
+	return wait
+}
@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestMonitor_schedule(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+	clock := &fixedClock{now: start}
+
+	mon := New(
+		WithClock(clock),
+		WithPeriod(2*time.Minute),
+		Capabilities(MonitorCapabilities{
+			{Name: "battery", Interval: time.Hour},
+			{Name: "powerMeter", Interval: 30 * time.Second},
+			{Name: "switch"},
+		}),
+	)
+
+	battery := deviceWithCapability{DeviceId: uuid.New(), ComponentId: "main", CapabilityId: "battery"}
+	power := deviceWithCapability{DeviceId: uuid.New(), ComponentId: "main", CapabilityId: "powerMeter"}
+	sw := deviceWithCapability{DeviceId: uuid.New(), ComponentId: "main", CapabilityId: "switch"}
+
+	for _, dev := range []deviceWithCapability{battery, power, sw} {
+		if !mon.due(dev, start) {
+			t.Errorf("Monitor.due() %s never polled should be due", dev.CapabilityId)
+		}
+		mon.schedule(dev, start)
+	}
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		due   map[string]bool
+	}{
+		{name: "right after", after: 0, due: map[string]bool{"battery": false, "powerMeter": false, "switch": false}},
+		{name: "power interval", after: 30 * time.Second, due: map[string]bool{"battery": false, "powerMeter": true, "switch": false}},
+		{name: "monitor period", after: 2 * time.Minute, due: map[string]bool{"battery": false, "powerMeter": true, "switch": true}},
+		{name: "battery interval", after: time.Hour, due: map[string]bool{"battery": true, "powerMeter": true, "switch": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dev := range []deviceWithCapability{battery, power, sw} {
+				if got := mon.due(dev, start.Add(tt.after)); got != tt.due[dev.CapabilityId] {
+					t.Errorf("Monitor.due() %s = %v, want %v", dev.CapabilityId, got, tt.due[dev.CapabilityId])
+				}
+			}
+		})
+	}
+
+	if got := mon.NextDue(DeviceDataPoint{DeviceId: battery.DeviceId, Component: "main", Capability: "battery"}); !got.Equal(start.Add(time.Hour)) {
+		t.Errorf("Monitor.NextDue() = %v, want %v", got, start.Add(time.Hour))
+	}
+
+	if got := mon.untilNextDue(); got != 30*time.Second {
+		t.Errorf("Monitor.untilNextDue() = %v, want %v", got, 30*time.Second)
+	}
+
+	clock.now = start.Add(time.Minute)
+	if got := mon.untilNextDue(); got != minimumSleep {
+		t.Errorf("Monitor.untilNextDue() overdue = %v, want %v", got, minimumSleep)
+	}
+}
+
+func TestMonitor_retry(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2023-01-01T10:00:00Z")
+
+	mon := New(
+		WithClock(&fixedClock{now: start}),
+		WithPeriod(2*time.Minute),
+		Capabilities(MonitorCapabilities{
+			{Name: "battery", Interval: time.Hour},
+			{Name: "powerMeter", Interval: 30 * time.Second},
+		}),
+	)
+
+	battery := deviceWithCapability{DeviceId: uuid.New(), ComponentId: "main", CapabilityId: "battery"}
+	power := deviceWithCapability{DeviceId: uuid.New(), ComponentId: "main", CapabilityId: "powerMeter"}
+
+	mon.retry(battery, start)
+	mon.retry(power, start)
+
+	if got := mon.nextDue[scheduleKey(battery.DeviceId, "main", "battery")]; !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("Monitor.retry() battery next due = %v, want the monitor period %v", got, start.Add(2*time.Minute))
+	}
+	if got := mon.nextDue[scheduleKey(power.DeviceId, "main", "powerMeter")]; !got.Equal(start.Add(30 * time.Second)) {
+		t.Errorf("Monitor.retry() power next due = %v, want its interval %v", got, start.Add(30*time.Second))
+	}
+
+	mon.unschedule([]deviceWithCapability{power})
+	if _, ok := mon.nextDue[scheduleKey(battery.DeviceId, "main", "battery")]; ok {
+		t.Errorf("Monitor.unschedule() kept the poll of a device no longer monitored")
+	}
+	if _, ok := mon.nextDue[scheduleKey(power.DeviceId, "main", "powerMeter")]; !ok {
+		t.Errorf("Monitor.unschedule() removed the poll of a monitored device")
+	}
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"log"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
+)
+
+// seriesState is what the monitor knows about the last record of a
+// time series.
+type seriesState struct {
+	// timestamp is the timestamp of the last recorded point
+	timestamp time.Time
+	// written is the wall time the last point was recorded
+	written time.Time
+	// value is the value of the last recorded reading
+	value float64
+}
+
+// selectUpdates returns the data points that have to be recorded at now.
+// Points whose timestamp did not change since their last record are
+// skipped for capabilities with dedup, unless their heartbeat expired.
+// In that case the point is recorded again at now, flagged as heartbeat.
+// Points whose value is within the capability deadband are skipped
+// unless the series was silent for longer than the deadband allows, or
+// are recorded as heartbeat as well when it expired.
+// Series state is the one of what was recorded to the sink. Skips are
+// logged only when logSkips is set, so they are logged once per cycle.
+func (mon Monitor) selectUpdates(s *sink, dataPoints []DeviceDataPoint, now time.Time, logSkips bool) []DeviceDataPoint {
+	updates := []DeviceDataPoint{}
+
+	for _, dp := range dataPoints {
+		settings := mon.settings(dp.DeviceId, dp.Device, dp.Capability)
+		state, known := s.series[dp.series()]
+
+		if !known {
+			updates = append(updates, dp)
+
+			continue
+		}
+
+		changed := !settings.Dedup || state.timestamp != dp.Timestamp
+		withinDeadband := changed && !settings.Deadband.IsEmpty() && settings.Deadband.Suppresses(state.value, dp.Value) &&
+			(settings.Deadband.MaxSilence <= 0 || now.Sub(state.written) < settings.Deadband.MaxSilence)
+
+		if changed && !withinDeadband {
+			// Device updated, add to the update list
+			updates = append(updates, dp)
+
+			continue
+		}
+
+		// Readings not recorded still get their heartbeat
+		if settings.Heartbeat > 0 && now.Sub(state.written) >= settings.Heartbeat {
+			if logSkips {
+				log.Printf("No changes for device %s[%s] %s since %s. Sending heartbeat.", dp.Device, dp.DeviceId, dp.Key, state.written)
+			}
+			dp.Timestamp = now
+			dp.Heartbeat = true
+			updates = append(updates, dp)
+
+			continue
+		}
+
+		if withinDeadband {
+			if logSkips {
+				log.Printf("Change of %s for device %s[%s] from %f to %f within deadband. Skipping.", dp.Key, dp.Device, dp.DeviceId, state.value, dp.Value)
+			}
+			metrics.DeadbandSkips.WithLabelValues(s.Name).Inc()
+
+			continue
+		}
+
+		if logSkips {
+			log.Printf("No changes since last query for device %s[%s]. Skipping.", dp.Device, dp.DeviceId)
+		}
+		metrics.DedupSkips.WithLabelValues(s.Name).Inc()
+	}
+
+	return updates
+}
+
+// commit updates the series state of the sink with the data points
+// recorded at now.
+func (mon Monitor) commit(s *sink, dataPoints []DeviceDataPoint, now time.Time) {
+	for _, dp := range dataPoints {
+		state := s.series[dp.series()]
+		// Heartbeats do not move the reading timestamp so the reading
+		// keeps being compared against the sensor time
+		if !dp.Heartbeat {
+			state.timestamp = dp.Timestamp
+			state.value = dp.Value
+		}
+		state.written = now
+		s.series[dp.series()] = state
+	}
+}
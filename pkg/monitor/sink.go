@@ -0,0 +1,216 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
+)
+
+// NamedRecorder is a recorder identified by name in logs and errors.
+type NamedRecorder struct {
+	Name string
+	Recorder
+}
+
+// MultiRecorder records to all its recorders. A failing recorder does not
+// keep the others from being written, their errors are joined.
+type MultiRecorder []NamedRecorder
+
+func (m MultiRecorder) Add(datapoints []DeviceDataPoint) error {
+	errs := []error{}
+
+	for _, r := range m {
+		if err := r.write(datapoints); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// write adds the data points to the recorder observing the write metrics
+// under the recorder name.
+func (r NamedRecorder) write(datapoints []DeviceDataPoint) error {
+	err := r.Add(datapoints)
+	if err != nil {
+		metrics.ObserveWrite(r.Name, 0, len(datapoints))
+		return err
+	}
+	metrics.ObserveWrite(r.Name, len(datapoints), 0)
+
+	return nil
+}
+
+// Open opens all recorders.
+func (m MultiRecorder) Open() error {
+	return m.each(Open)
+}
+
+// Flush flushes all recorders.
+func (m MultiRecorder) Flush() error {
+	return m.each(Flush)
+}
+
+// Close flushes and closes all recorders, a failing one does not keep the
+// others from being closed.
+func (m MultiRecorder) Close() error {
+	return m.each(Close)
+}
+
+func (m MultiRecorder) each(f func(Recorder) error) error {
+	errs := []error{}
+
+	for _, r := range m {
+		if err := f(r.Recorder); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sink is a recorder along with the state of what was recorded to it, so
+// each recorder gets the points it missed regardless of the others.
+type sink struct {
+	NamedRecorder
+	series map[string]seriesState
+	stale  map[string]bool
+	// pending are the inventory events not recorded yet
+	pending []DeviceDataPoint
+	// inflight is a write that timed out and is still running
+	inflight *write
+	// opened tells the recorder was opened, it is opened again before
+	// writing until it succeeds
+	opened bool
+}
+
+// write is a write to a sink, its state is committed once it succeeds.
+type write struct {
+	updates []DeviceDataPoint
+	stale   []DeviceDataPoint
+	// events is how many pending inventory events were written
+	events int
+	now    time.Time
+	done   chan error
+}
+
+func newSink(name string, recorder Recorder) *sink {
+	return &sink{
+		NamedRecorder: NamedRecorder{Name: name, Recorder: recorder},
+		series:        make(map[string]seriesState),
+		stale:         make(map[string]bool),
+	}
+}
+
+// record writes to the sink the data points that changed since last
+// recorded to it along with staleness and inventory events. It returns
+// the updates recorded. A write not done by the time ctx is done keeps
+// running, the sink is not written again until it finishes.
+func (mon Monitor) record(ctx context.Context, s *sink, dataPoints []DeviceDataPoint, inventoryEvents []DeviceDataPoint, now time.Time, logSkips bool) ([]DeviceDataPoint, error) {
+	s.pending = append(s.pending, inventoryEvents...)
+
+	if s.inflight != nil {
+		select {
+		case err := <-s.inflight.done:
+			mon.settle(s, s.inflight, err)
+		default:
+			return nil, fmt.Errorf("%s: previous write still running", s.Name)
+		}
+	}
+
+	w := &write{
+		updates: mon.selectUpdates(s, dataPoints, now, logSkips),
+		stale:   mon.staleEvents(s, dataPoints, now),
+		events:  len(s.pending),
+		now:     now,
+		done:    make(chan error, 1),
+	}
+
+	records := append(append(append([]DeviceDataPoint{}, w.updates...), w.stale...), s.pending...)
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	go func() {
+		if err := s.open(); err != nil {
+			w.done <- fmt.Errorf("could not open: %w", err)
+			return
+		}
+		w.done <- s.write(records)
+	}()
+
+	select {
+	case err := <-w.done:
+		if err := mon.settle(s, w, err); err != nil {
+			return nil, err
+		}
+
+		return w.updates, nil
+	case <-ctx.Done():
+		s.inflight = w
+
+		return nil, fmt.Errorf("%s: write not done: %w", s.Name, ctx.Err())
+	}
+}
+
+// open opens the recorder of the sink unless already opened.
+func (s *sink) open() error {
+	if s.opened {
+		return nil
+	}
+
+	if err := Open(s.Recorder); err != nil {
+		return err
+	}
+	s.opened = true
+
+	return nil
+}
+
+// settle commits the state of a finished write to the sink.
+func (mon Monitor) settle(s *sink, w *write, err error) error {
+	s.inflight = nil
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Name, err)
+	}
+
+	// Update series state only when the record is serialized
+	mon.commit(s, w.updates, w.now)
+	mon.commitStale(s, w.stale)
+	s.pending = s.pending[w.events:]
+
+	return nil
+}
+
+// recorders returns the recorders of all sinks.
+func (mon Monitor) recorders() MultiRecorder {
+	recorders := make(MultiRecorder, 0, len(mon.sinks))
+	for _, s := range mon.sinks {
+		recorders = append(recorders, s.NamedRecorder)
+	}
+
+	return recorders
+}
+
+// Open opens the recorders checking they can be written. A failing
+// recorder does not keep the others from being opened, it is opened again
+// before it is next written.
+func (mon Monitor) Open() error {
+	errs := []error{}
+
+	for _, s := range mon.sinks {
+		if err := s.open(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close flushes and closes the recorders.
+func (mon Monitor) Close() error {
+	return mon.recorders().Close()
+}
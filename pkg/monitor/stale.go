@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"log"
+	"time"
+)
+
+// SensorStaleMeasurement is the measurement recording when a sensor
+// becomes stale (1) or fresh again (0).
+const SensorStaleMeasurement = "sensorStale"
+
+// staleEvents returns sensorStale points for the readings that crossed
+// their capability staleness threshold since the last event recorded to
+// the sink.
+func (mon Monitor) staleEvents(s *sink, dataPoints []DeviceDataPoint, now time.Time) []DeviceDataPoint {
+	return mon.staleTransitions(s.stale, dataPoints, now)
+}
+
+// staleTransitions returns sensorStale points for the readings whose
+// staleness differs from the one kept in stale.
+func (mon Monitor) staleTransitions(stale map[string]bool, dataPoints []DeviceDataPoint, now time.Time) []DeviceDataPoint {
+	events := []DeviceDataPoint{}
+
+	for _, dp := range dataPoints {
+		threshold := mon.settings(dp.DeviceId, dp.Device, dp.Capability).Stale
+		if threshold <= 0 {
+			continue
+		}
+
+		isStale := now.Sub(dp.SensorTime) > threshold
+		if isStale == stale[dp.series()] {
+			continue
+		}
+
+		value := 0.0
+		if isStale {
+			value = 1.0
+		}
+
+		events = append(events, DeviceDataPoint{
+			Key:        SensorStaleMeasurement,
+			DeviceId:   dp.DeviceId,
+			Device:     dp.Device,
+			Room:       dp.Room,
+			Component:  dp.Component,
+			Capability: dp.Capability,
+			Value:      value,
+			Timestamp:  now,
+			SensorTime: dp.SensorTime,
+			Tags:       map[string]string{"attribute": dp.Key},
+		})
+	}
+
+	return events
+}
+
+// logStale logs the readings becoming stale or fresh again, once
+// regardless of the databases they are recorded to.
+func (mon Monitor) logStale(dataPoints []DeviceDataPoint, now time.Time) {
+	for _, ev := range mon.staleTransitions(mon.stale, dataPoints, now) {
+		reading := staleReading(ev)
+
+		if ev.Value > 0 {
+			log.Printf("WARNING: sensor %s[%s] %s is stale, last reading at %s", ev.Device, ev.DeviceId, reading.Key, ev.SensorTime)
+		} else {
+			log.Printf("Sensor %s[%s] %s is fresh again, last reading at %s", ev.Device, ev.DeviceId, reading.Key, ev.SensorTime)
+		}
+
+		mon.stale[reading.series()] = ev.Value > 0
+	}
+}
+
+// commitStale keeps the staleness of the events recorded to the sink.
+func (mon Monitor) commitStale(s *sink, events []DeviceDataPoint) {
+	for _, ev := range events {
+		s.stale[staleReading(ev).series()] = ev.Value > 0
+	}
+}
+
+// staleReading returns the reading a sensorStale event is about.
+func staleReading(ev DeviceDataPoint) DeviceDataPoint {
+	reading := ev
+	reading.Key = ev.Tags["attribute"]
+
+	return reading
+}
+
+// StaleReading is a reading older than a given age.
+type StaleReading struct {
+	Point DeviceDataPoint
+	Age   time.Duration
+}
+
+// StaleReadings returns the data points whose sensor reading is older
+// than age at now.
+func StaleReadings(dataPoints []DeviceDataPoint, age time.Duration, now time.Time) []StaleReading {
+	stale := []StaleReading{}
+
+	for _, dp := range dataPoints {
+		if now.Sub(dp.SensorTime) > age {
+			stale = append(stale, StaleReading{Point: dp, Age: now.Sub(dp.SensorTime)})
+		}
+	}
+
+	return stale
+}
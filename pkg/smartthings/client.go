@@ -6,4 +6,5 @@ type Client interface {
 	Devices() (devices DevicesList, err error)
 	// DeviceStatus(deviceID uuid.UUID) (status DeviceStatus, err error)
 	DeviceCapabilityStatus(deviceID uuid.UUID, componentId string, capabilityId string) (status map[string]CapabilityStatus, err error)
+	Rooms(locationID uuid.UUID) (rooms RoomsList, err error)
 }
@@ -5,10 +5,28 @@ import (
 )
 
 type Device struct {
-	DeviceId   uuid.UUID   `json:"deviceId"`
-	Name       string      `json:"name"`
-	Label      string      `json:"label"`
-	Components []Component `json:"components"`
+	DeviceId       uuid.UUID   `json:"deviceId"`
+	Name           string      `json:"name"`
+	Label          string      `json:"label"`
+	LocationId     uuid.UUID   `json:"locationId"`
+	RoomId         uuid.UUID   `json:"roomId"`
+	DeviceTypeName string      `json:"deviceTypeName"`
+	Profile        Profile     `json:"profile"`
+	Components     []Component `json:"components"`
+}
+
+type Profile struct {
+	Id string `json:"id"`
+}
+
+type Room struct {
+	RoomId     uuid.UUID `json:"roomId"`
+	LocationId uuid.UUID `json:"locationId"`
+	Name       string    `json:"name"`
+}
+
+type RoomsList struct {
+	Items []Room `json:"items"`
 }
 
 type Component struct {
@@ -0,0 +1,25 @@
+package smartthings
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned when SmartThings answers with a non success status.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("SmartThings API returned status %d for '%s': %s", e.StatusCode, e.Endpoint, e.Body)
+}
+
+// IsNotFound tells if the error is a SmartThings not found answer.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
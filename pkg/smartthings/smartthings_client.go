@@ -6,7 +6,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/eargollo/smartthings-influx/pkg/metrics"
 	"github.com/google/uuid"
 )
 
@@ -37,6 +39,19 @@ func (c STClient) Devices() (DevicesList, error) {
 	return devices, err
 }
 
+func (c STClient) Rooms(locationID uuid.UUID) (RoomsList, error) {
+	var rooms RoomsList
+
+	data, err := c.get("/locations/" + locationID.String() + "/rooms")
+	if err != nil {
+		return rooms, err
+	}
+
+	err = json.Unmarshal(data, &rooms)
+
+	return rooms, err
+}
+
 func (c STClient) DeviceCapabilityStatus(deviceID uuid.UUID, componentId string, capabilityId string) (status map[string]CapabilityStatus, err error) {
 	url := "/devices/" + deviceID.String() + "/components/" + componentId + "/capabilities/" + capabilityId + "/status"
 
@@ -65,10 +80,13 @@ func (c STClient) get(endpoint string) ([]byte, error) {
 
 	// Send req using http Client
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.ObserveRequest(0, time.Since(start))
 		return []byte{}, err
 	}
+	metrics.ObserveRequest(resp.StatusCode, time.Since(start))
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
@@ -81,6 +99,10 @@ func (c STClient) get(endpoint string) ([]byte, error) {
 		return []byte{}, err
 	}
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, &APIError{StatusCode: resp.StatusCode, Endpoint: endpoint, Body: string(body)}
+	}
+
 	return body, nil
 }
 